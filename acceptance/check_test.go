@@ -2,6 +2,7 @@ package acceptance_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -44,7 +45,7 @@ var _ = Describe("check", func() {
 			// this client isn't well tested, so we're going
 			// to violate some abstraction layers to test it here
 			// against the real api
-			client, err := storage.NewStorageClient(serviceAccountKey, envName, bucketName)
+			client, err := storage.NewStorageClient(context.Background(), serviceAccountKey, envName, bucketName, storage.Options{CreateBucket: true})
 			Expect(err).NotTo(HaveOccurred())
 			return client
 		}
@@ -64,7 +65,7 @@ var _ = Describe("check", func() {
 				_, err = f.Write([]byte(bblStateContents))
 				Expect(err).NotTo(HaveOccurred())
 
-				result, err = client.Upload(uploadDir)
+				result, err = client.Upload(context.Background(), uploadDir)
 				Expect(err).NotTo(HaveOccurred())
 			})
 			return result
@@ -77,7 +78,7 @@ var _ = Describe("check", func() {
 		})
 
 		AfterEach(func() {
-			err := buildStorageClient(name).DeleteBucket()
+			err := buildStorageClient(name).DeleteBucket(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -117,7 +118,7 @@ var _ = Describe("check", func() {
 			})
 
 			AfterEach(func() {
-				_ = buildStorageClient(newerName).DeleteBucket()
+				_ = buildStorageClient(newerName).DeleteBucket(context.Background())
 			})
 
 			It("prints version for environments as new or newer than the version in the checkRequest", func() {
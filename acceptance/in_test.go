@@ -2,6 +2,7 @@ package acceptance_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -43,7 +44,7 @@ var _ = Describe("in", func() {
 		// to violate some abstraction layers to test it here
 		// against the real api
 		name = fmt.Sprintf("bsr-test-in-%d-%s", GinkgoParallelProcess(), projectId)
-		client, err := storage.NewStorageClient(serviceAccountKey, name, bucket)
+		client, err := storage.NewStorageClient(context.Background(), serviceAccountKey, name, bucket, storage.Options{CreateBucket: true})
 		Expect(err).NotTo(HaveOccurred())
 
 		By("uploading a bogus bbl state with some unique contents", func() {
@@ -58,7 +59,7 @@ var _ = Describe("in", func() {
 			_, err = f.Write([]byte(bblStateContents))
 			Expect(err).NotTo(HaveOccurred())
 
-			version, err = client.Upload(uploadDir)
+			version, err = client.Upload(context.Background(), uploadDir)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -84,7 +85,7 @@ var _ = Describe("in", func() {
 			session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(session, 10).Should(gexec.Exit(0))
-			Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":"%s","updated":".+"}}`, name, version.Ref)))
+			Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":"%s","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}\]}`, name, version.Ref)))
 			f, err := os.Open(filepath.Join(targetDir, "bbl-state.json"))
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(gbytes.BufferReader(f)).Should(gbytes.Say(bblStateContents))
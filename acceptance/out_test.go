@@ -33,6 +33,7 @@ var _ = Describe("out", func() {
 			upRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -51,6 +52,7 @@ var _ = Describe("out", func() {
 			downRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -73,7 +75,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 40*time.Minute).Should(gexec.Exit(0), "bbl down should've suceeded!")
-				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 				_, err = os.Stat(filepath.Join(downSourcesDir, "bbl-state", "bbl-state.json"))
 				Expect(err).To(HaveOccurred())
 
@@ -89,7 +91,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 40*time.Minute).Should(gexec.Exit(0), "bbl up should've suceeded!")
-				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 				_, err = os.Open(filepath.Join(upSourcesDir, "bbl-state", "bbl-state.json"))
 				Expect(err).NotTo(HaveOccurred())
 
@@ -122,6 +124,7 @@ var _ = Describe("out", func() {
 			upRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -148,6 +151,7 @@ var _ = Describe("out", func() {
 			downRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -170,7 +174,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 40*time.Minute).Should(gexec.Exit(0), "bbl down should've suceeded!")
-				// Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				// Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 				_, err = os.Stat(filepath.Join(downSourcesDir, "bbl-state", "bbl-state.json"))
 				Expect(err).To(HaveOccurred())
 
@@ -188,7 +192,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 40*time.Minute).Should(gexec.Exit(0), "bbl up should've suceeded!")
-				// Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				// Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 				Eventually(session.Err).Should(gbytes.Say("plan patch has been successfully applied!"))
 			})
 		})
@@ -211,6 +215,7 @@ var _ = Describe("out", func() {
 			upRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -266,6 +271,7 @@ var _ = Describe("out", func() {
 			badRequest := fmt.Sprintf(`{
 				"source": {
 					"bucket": "bsr-acc-tests-%s",
+					"create_bucket": true,
 					"iaas": "gcp",
 					"gcp_region": "us-east1",
 					"gcp_service_account_key": %s
@@ -293,7 +299,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 10).Should(gexec.Exit(1), "bbl up should've failed when we misconfigured it")
-				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 
 				_, err = os.Open(filepath.Join(sourcesDir, "bbl-state", "bdr-source-file"))
 				Expect(err).NotTo(HaveOccurred())
@@ -321,7 +327,7 @@ var _ = Describe("out", func() {
 				session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 				Expect(err).NotTo(HaveOccurred())
 				Eventually(session, 10).Should(gexec.Exit(0))
-				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"}}`, name)))
+				Eventually(session.Out).Should(gbytes.Say(fmt.Sprintf(`{"version":{"name":"%s","ref":".+","updated":".+"},"metadata":\[{"name":"name","value":"%[1]s"}.*\]}`, name)))
 
 				f, err := os.Open(filepath.Join(getTargetDir, "terraform", "broken_override.tf"))
 				Expect(err).NotTo(HaveOccurred())
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/cloudfoundry/bbl-state-resource/concourse"
 	"github.com/cloudfoundry/bbl-state-resource/storage"
@@ -23,17 +26,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ctx, cancel, err := checkRequest.Source.Context(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+	defer cancel()
+
+	storageOptions, err := checkRequest.Source.StorageOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+	// a check never creates anything, even if the bucket is missing
+	storageOptions.ReadOnly = true
+
 	storageClient, err := storage.NewStorageClient(
+		ctx,
 		checkRequest.Source.GCPServiceAccountKey,
 		checkRequest.Version.Name,
 		checkRequest.Source.Bucket,
+		storageOptions,
 	)
+	if err == storage.BucketNotFoundError {
+		fmt.Fprintf(os.Stdout, `[]`)
+		os.Exit(0)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create storage client: %s\n", err)
 		os.Exit(1)
 	}
 
-	versions, err := storageClient.GetAllNewerVersions(checkRequest.Version)
+	versions, err := storageClient.GetAllNewerVersions(ctx, checkRequest.Version)
 	if err == storage.ObjectNotFoundError {
 		fmt.Fprintf(os.Stdout, `[]`)
 		os.Exit(0)
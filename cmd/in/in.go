@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
 	"github.com/cloudfoundry/bbl-state-resource/storage"
 )
 
@@ -31,20 +36,93 @@ func main() {
 		os.Exit(1)
 	}
 
-	storageClient, err := storage.NewStorageClient(req.Source.GCPServiceAccountKey, req.Version.Name, req.Source.Bucket)
+	// a dry run against an environment with no state yet emits a version
+	// without a ref, and there's nothing to fetch for it
+	if req.Version.Ref == "" {
+		metadata := outrunner.Metadata(req.Version.Name, outrunner.BblState{})
+		err = json.NewEncoder(os.Stdout).Encode(concourse.Response{Version: req.Version, Metadata: metadata})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal version: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ctx, cancel, err := req.Source.Context(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create storage client: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
 		os.Exit(1)
 	}
+	defer cancel()
 
-	version, err := storageClient.Download(os.Args[1])
+	storageOptions, err := req.Source.StorageOptions()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to download bbl state: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
 		os.Exit(1)
 	}
+	// a get never creates anything, even if the bucket or state is missing
+	storageOptions.ReadOnly = true
+
+	storageClient, err := storage.NewStorageClient(ctx, req.Source.GCPServiceAccountKey, req.Version.Name, req.Source.Bucket, storageOptions)
+	if err == storage.BucketNotFoundError {
+		fmt.Fprintf(os.Stderr, "bucket %s does not exist\n", req.Source.Bucket)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create storage client: %s\n", err)
+		os.Exit(1)
+	}
+
+	var version storage.Version
+	if req.Params.SkipDownload {
+		version, err = storageClient.Version(ctx)
+		if err == storage.ObjectNotFoundError {
+			fmt.Fprintf(os.Stderr, "there is no bbl state for %s\n", req.Version.Name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get bbl state version: %s\n", err)
+			os.Exit(1)
+		}
+	} else {
+		version, err = storageClient.DownloadWithOptions(ctx, os.Args[1], storage.DownloadOptions{Files: req.Params.Files})
+		if err == storage.ObjectNotFoundError {
+			fmt.Fprintf(os.Stderr, "there is no bbl state for %s\n", req.Version.Name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to download bbl state: %s\n", err)
+			os.Exit(1)
+		}
+		// states uploaded before bosh-env.sh existed get one too. a partial download
+		// has already got exactly the files it asked for, regenerating them could only lose some
+		if len(req.Params.Files) == 0 {
+			outrunner.SyncInteropFiles(outrunner.NewStateDir(os.Args[1]))
+		}
+	}
+
+	if req.Params.AuditLog {
+		records, err := storageClient.ReadRecords(ctx, outrunner.AuditRecordKind)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read audit log: %s\n", err)
+			os.Exit(1)
+		}
+
+		log, err := outrunner.AuditLog(records)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(os.Args[1], outrunner.AuditLogFile), log, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write audit log: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	outMap := map[string]storage.Version{"version": version}
-	err = json.NewEncoder(os.Stdout).Encode(outMap)
+	state, _ := outrunner.NewStateDir(os.Args[1]).Read()
+	metadata := outrunner.Metadata(version.Name, state)
+	err = json.NewEncoder(os.Stdout).Encode(concourse.Response{Version: version, Metadata: metadata})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to marshal version: %s\n", err)
 		os.Exit(1)
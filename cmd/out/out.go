@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry/bbl-state-resource/concourse"
 	"github.com/cloudfoundry/bbl-state-resource/outrunner"
@@ -39,20 +43,117 @@ func main() {
 		os.Exit(1)
 	}
 
+	command, err := outrunner.LookupCommand(req.Params.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	args, err := outrunner.Args(sourcesDir, req.Params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = command.ValidateArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	flags, err := outrunner.AppendSourceFlags(args, req.Source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
 	name, err := outrunner.Name(sourcesDir, req.Params)
 	if err != nil {
 		fmt.Fprint(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	storageClient, err := storage.NewStorageClient(req.Source.GCPServiceAccountKey, name, req.Source.Bucket)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ctx, cancel, err := req.Source.Context(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+	defer cancel()
+
+	abortGracePeriod, err := req.Source.AbortGracePeriod()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	storageOptions, err := req.Source.StorageOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	storageClient, err := storage.NewStorageClient(ctx, req.Source.GCPServiceAccountKey, name, req.Source.Bucket, storageOptions)
+	if err == storage.BucketNotFoundError {
+		fmt.Fprintf(os.Stderr, "bucket %s does not exist, set create_bucket: true in source to have put create it\n", req.Source.Bucket)
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create storage client: %s\n", err)
 		os.Exit(1)
 	}
 
+	var spool *storage.Spool
+	// reconciling uploads, so a dry run leaves the spool for the next real put
+	if req.Source.Spool != nil && !req.Params.DryRun {
+		s, err := newSpool(ctx, *req.Source.Spool, req.Source, name, storageOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create spool: %s\n", err)
+			os.Exit(1)
+		}
+		spool = &s
+
+		reconciled, err := reconcileSpool(ctx, s, storageClient, name, req.Params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to reconcile spooled bbl state from %s: %s\n", s.Location, err)
+			os.Exit(1)
+		}
+		if reconciled && req.Params.StateDir != "" {
+			fmt.Fprintf(os.Stderr, "%s predates the spooled state that was just reconciled; get the latest version of %s and try again\n", req.Params.StateDir, name)
+			os.Exit(1)
+		}
+	}
+
+	stateExists := true
+	current, err := storageClient.Version(ctx)
+	if err == storage.ObjectNotFoundError {
+		stateExists = false
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to look up bbl state: %s\n", err)
+		os.Exit(1)
+	}
+
+	override, err := outrunner.CheckProtection(command, name, req.Params, current.Metadata)
+	if err != nil {
+		if !req.Params.DryRun {
+			fmt.Fprintf(os.Stderr, "Refusing to run: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dry run: the put would be refused: %s\n", err)
+	}
+	if override {
+		fmt.Fprintf(os.Stderr, "%s is protected, but confirm_name matches: continuing with bbl %s\n", name, command.Name)
+	}
+	metadata := outrunner.NextMetadata(current.Metadata, req.Params, command, override)
+
 	bblStateDir := filepath.Join(sourcesDir, req.Params.StateDir)
 	if req.Params.StateDir == "" {
+		if !stateExists && command.StateRequired(args) {
+			fmt.Fprintf(os.Stderr, "bbl %s needs an existing environment, but there is no bbl state for %s\n", command.Name, name)
+			os.Exit(1)
+		}
+
 		bblStateDir = filepath.Join(sourcesDir, "bbl-state")
 		err = os.Mkdir(bblStateDir, os.ModePerm)
 		if err != nil {
@@ -60,37 +161,152 @@ func main() {
 			os.Exit(1)
 		}
 
-		_, err = storageClient.Download(bblStateDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to download bbl state: %s\n", err)
-			os.Exit(1)
+		// Download would upload an empty initial state, which a dry run mustn't
+		if stateExists || !req.Params.DryRun {
+			_, err = storageClient.Download(ctx, bblStateDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to download bbl state: %s\n", err)
+				os.Exit(1)
+			}
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "running something like 'bbl %s --state-dir=%s'...\n", req.Params.Command, bblStateDir)
+	// a get with audit_log leaves the log in the state dir, it isn't part of the state
+	err = os.Remove(filepath.Join(bblStateDir, outrunner.AuditLogFile))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "failed to remove %s from the bbl state: %s\n", outrunner.AuditLogFile, err)
+		os.Exit(1)
+	}
 
 	stateDir := outrunner.NewStateDir(bblStateDir)
 
+	bblVersion := outrunner.BBLVersion(ctx, "bbl")
+	previousState, _ := stateDir.Read()
+	warnings, err := outrunner.CheckCompatibility(previousState, bblVersion, command, req.Params)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	if err != nil {
+		if !req.Params.DryRun {
+			fmt.Fprintf(os.Stderr, "Refusing to run: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dry run: the put would be refused: %s\n", err)
+	}
+
+	if req.Params.DryRun {
+		dryRunError := dryRun(ctx, abortGracePeriod, name, stateDir, command, flags, req.Params.PlanPatches)
+		if dryRunError != nil {
+			fmt.Fprintf(os.Stderr, "dry run failed: %s\n", dryRunError)
+		}
+
+		version, err := storageClient.Version(context.Background())
+		if err == storage.ObjectNotFoundError {
+			version = storage.Version{Name: name}
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get bbl state version: %s\n", err)
+			os.Exit(1)
+		}
+
+		state, _ := stateDir.Read()
+		metadata := append(outrunner.Metadata(name, state), concourse.MetadataField{Name: "command", Value: fmt.Sprintf("%s (dry run)", command.Name)})
+		err = json.NewEncoder(os.Stdout).Encode(concourse.Response{Version: version, Metadata: metadata})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal version: %s\n", err)
+			os.Exit(1)
+		}
+		if dryRunError != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "running something like 'bbl %s --state-dir=%s'...\n", command.Name, bblStateDir)
+
 	if err := stateDir.ApplyPlanPatches(req.Params.PlanPatches); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to apply plan-patches to bbl state: %s\n", err)
 		os.Exit(1)
 	}
 
-	bblError := outrunner.RunBBL(name, stateDir, req.Params.Command, outrunner.AppendSourceFlags(req.Params.Args, req.Source))
+	// the ref of the last state this put left in the bucket, which a spooled state is built on
+	baseRef := current.Ref
+	checkpointer, checkpointing, err := outrunner.NewCheckpointer(req.Source, bblStateDir, func(ctx context.Context) error {
+		checkpoint, err := storageClient.UploadWithMetadata(ctx, bblStateDir, withStatus(metadata, storage.StatusInProgress))
+		if err == nil {
+			baseRef = checkpoint.Ref
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", err)
+		os.Exit(1)
+	}
+
+	// overrides and protection changes are recorded in a new version, even for commands that don't change the state
+	upload := command.UploadState || override || req.Params.Protected != nil
+
+	checkpointCtx, stopCheckpointing := context.WithCancel(ctx)
+	var checkpointed <-chan struct{}
+	if checkpointing && command.UploadState {
+		checkpointed = checkpointer.Start(checkpointCtx)
+	}
+
+	startedAt := time.Now()
+	bblError := outrunner.RunBBL(ctx, abortGracePeriod, name, stateDir, command.Name, flags)
+	bblDuration := time.Since(startedAt)
+	stopCheckpointing()
+	if checkpointed != nil {
+		<-checkpointed
+	}
 	if bblError != nil {
 		fmt.Fprintf(os.Stderr, "failed to run bbl command: %s\n", bblError)
 	}
 
-	version, err := storageClient.Upload(bblStateDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to upload bbl state: %s\n", err)
-		os.Exit(1)
+	var version storage.Version
+	if upload {
+		// whatever bbl did has to be saved, even if the put has been aborted
+		uploadCtx := context.Background()
+
+		version, err = storageClient.UploadWithMetadata(uploadCtx, bblStateDir, withStatus(metadata, storage.StatusComplete))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to upload bbl state: %s\n", err)
+			if spool == nil || !spoolState(uploadCtx, *spool, name, bblStateDir, baseRef) {
+				saveUnuploadedState(uploadCtx, storageClient, sourcesDir, name, bblStateDir)
+			}
+
+			// the state bbl left behind isn't in the bucket, so there's no after-ref
+			record := outrunner.NewAuditRecord(command, flags, req.Params.PlanPatches, bblVersion, startedAt, bblDuration, bblError)
+			record.BeforeRef = current.Ref
+			uploadError := fmt.Sprintf("failed to upload bbl state: %s", err)
+			if record.Error != "" {
+				uploadError = record.Error + "; " + uploadError
+			}
+			record.Error = uploadError
+			writeAuditRecord(uploadCtx, storageClient, record)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "successfully uploaded bbl state!\n")
+	} else {
+		version, err = storageClient.Version(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get bbl state version: %s\n", err)
+			os.Exit(1)
+		}
 	}
 
-	fmt.Fprintf(os.Stderr, "successfully uploaded bbl state!\n")
+	record := outrunner.NewAuditRecord(command, flags, req.Params.PlanPatches, bblVersion, startedAt, bblDuration, bblError)
+	record.BeforeRef = current.Ref
+	record.AfterRef = version.Ref
+	writeAuditRecord(context.Background(), storageClient, record)
 
-	outMap := map[string]storage.Version{"version": version}
-	err = json.NewEncoder(os.Stdout).Encode(outMap)
+	// after a down there's no state left to describe, just the name
+	state, _ := stateDir.Read()
+	responseMetadata := append(outrunner.Metadata(name, state),
+		concourse.MetadataField{Name: "command", Value: command.Name},
+		concourse.MetadataField{Name: "duration", Value: record.Duration},
+	)
+	err = json.NewEncoder(os.Stdout).Encode(concourse.Response{Version: version, Metadata: responseMetadata})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to marshal version: %s\n", err)
 		os.Exit(1)
@@ -99,3 +315,141 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// best effort: a put that did its job shouldn't fail over its audit record
+func writeAuditRecord(ctx context.Context, storageClient storage.StorageClient, record outrunner.AuditRecord) {
+	contents, err := json.Marshal(record)
+	if err == nil {
+		err = storageClient.WriteRecord(ctx, outrunner.AuditRecordKind, contents)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write audit record: %s\n", err)
+	}
+}
+
+func withStatus(metadata map[string]string, status string) map[string]string {
+	result := map[string]string{storage.StatusMetadataKey: status}
+	for k, v := range metadata {
+		result[k] = v
+	}
+	return result
+}
+
+// shows what the put would do to the state without running the command itself:
+// planning commands are replaced by bbl plan, anything else is just printed
+func dryRun(ctx context.Context, gracePeriod time.Duration, name string, stateDir outrunner.StateDir, command outrunner.Command, flags concourse.Args, planPatches []string) error {
+	before, err := outrunner.TakeSnapshot(stateDir.Path())
+	if err != nil {
+		return fmt.Errorf("failed to read bbl state: %s", err)
+	}
+
+	if err := stateDir.ApplyPlanPatches(planPatches); err != nil {
+		return fmt.Errorf("failed to apply plan-patches to bbl state: %s", err)
+	}
+
+	invocation, err := outrunner.DescribeInvocation(name, stateDir, command.Name, flags)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dry run: the put would run:\n  %s\n", invocation)
+
+	if command.Plans {
+		fmt.Fprintf(os.Stderr, "dry run: running bbl plan instead...\n")
+		err = outrunner.RunBBL(ctx, gracePeriod, name, stateDir, "plan", flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	after, err := outrunner.TakeSnapshot(stateDir.Path())
+	if err != nil {
+		return fmt.Errorf("failed to read bbl state: %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "dry run: changes to the bbl state (not uploaded):\n%s", outrunner.Diff(before, after))
+	return nil
+}
+
+// the state dir is the only copy of whatever bbl just did,
+// so leave a tarball of it somewhere a human can hijack in and grab it
+func saveUnuploadedState(ctx context.Context, storageClient storage.StorageClient, sourcesDir, name, bblStateDir string) {
+	tarball := filepath.Join(sourcesDir, fmt.Sprintf("%s-bbl-state.tgz", name))
+
+	f, err := os.Create(tarball)
+	if err == nil {
+		err = storageClient.Archive(ctx, bblStateDir, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save bbl state to %s: %s\n", tarball, err)
+		fmt.Fprintf(os.Stderr, "the only remaining copy of the state for %s is in %s\n", name, bblStateDir)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\n!!! THE BBL STATE FOR %s WAS NOT UPLOADED !!!\n", name)
+	fmt.Fprintf(os.Stderr, "a copy has been saved to %s inside this container.\n", tarball)
+	fmt.Fprintf(os.Stderr, "recover it before concourse garbage collects the container, e.g.:\n")
+	fmt.Fprintf(os.Stderr, "  fly -t <target> hijack -b <build-id> -s <this-put-step> cat %s > %s-bbl-state.tgz\n\n", tarball, name)
+}
+
+func newSpool(ctx context.Context, config concourse.Spool, source concourse.Source, name string, opts storage.Options) (storage.Spool, error) {
+	if err := config.Validate(); err != nil {
+		return storage.Spool{}, err
+	}
+	if config.Dir != "" {
+		return storage.NewDirectorySpool(config.Dir, source.Bucket, name), nil
+	}
+	return storage.NewBucketSpool(ctx, source.GCPServiceAccountKey, config.Bucket, name, opts)
+}
+
+// a previous put couldn't upload, so its spooled state is newer than the
+// state it was built on: push it up before doing anything else, as long as
+// nothing else has replaced that state in the meantime
+func reconcileSpool(ctx context.Context, spool storage.Spool, storageClient storage.StorageClient, name string, params concourse.OutParams) (bool, error) {
+	tmpDir, err := ioutil.TempDir("", "spooled-bbl-state")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	baseRef, found, err := spool.Restore(ctx, tmpDir)
+	if err == storage.SpoolBaseRefUnknownError {
+		return false, fmt.Errorf("%s, so it can't be safely uploaded over the bucket's: compare the two by hand, put the one to keep in the bucket, then delete %s", err, spool.Location)
+	}
+	if err != nil || !found {
+		return false, err
+	}
+
+	fmt.Fprintf(os.Stderr, "found a spooled bbl state for %s at %s, uploading it before continuing...\n", name, spool.Location)
+	// the spool doesn't keep the bucket's metadata, so keep whatever protection the bucket has
+	current, err := storageClient.Version(ctx)
+	if err != nil && err != storage.ObjectNotFoundError {
+		return false, err
+	}
+	if current.Ref != baseRef {
+		return false, fmt.Errorf("the bbl state in the bucket has changed since the spooled state was built on it (ref %q, now %q), refusing to overwrite it: compare the two by hand, put the one to keep in the bucket, then delete %s", baseRef, current.Ref, spool.Location)
+	}
+	metadata := outrunner.NextMetadata(current.Metadata, concourse.OutParams{}, outrunner.Command{}, false)
+	_, err = storageClient.UploadWithMetadata(ctx, tmpDir, withStatus(metadata, storage.StatusComplete))
+	if err != nil {
+		return false, err
+	}
+
+	return true, spool.Discard(ctx)
+}
+
+func spoolState(ctx context.Context, spool storage.Spool, name, bblStateDir, baseRef string) bool {
+	err := spool.Save(ctx, bblStateDir, baseRef)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to spool bbl state to %s: %s\n", spool.Location, err)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "\n!!! THE BBL STATE FOR %s WAS NOT UPLOADED !!!\n", name)
+	fmt.Fprintf(os.Stderr, "it has been spooled to %s instead.\n", spool.Location)
+	fmt.Fprintf(os.Stderr, "the next put for %s will upload it before doing anything else.\n", name)
+	fmt.Fprintf(os.Stderr, "do NOT delete it until then: it is the only copy of this environment's latest state.\n\n")
+	return true
+}
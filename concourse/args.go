@@ -0,0 +1,139 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Arg is the value of a single bbl flag.
+// strings and numbers become --flag=value, lists become one --flag=value per item,
+// true becomes a bare --flag and false leaves the flag out entirely.
+type Arg struct {
+	Values []string
+	Switch bool
+}
+
+func StringArg(value string) Arg {
+	return Arg{Values: []string{value}}
+}
+
+func BoolArg(value bool) Arg {
+	return Arg{Switch: value}
+}
+
+func newArg(value interface{}) (Arg, error) {
+	switch v := value.(type) {
+	case nil:
+		return Arg{}, nil
+	case bool:
+		return BoolArg(v), nil
+	case []interface{}:
+		arg := Arg{}
+		for _, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return Arg{}, fmt.Errorf("list items must be strings or numbers: %s", err)
+			}
+			arg.Values = append(arg.Values, s)
+		}
+		return arg, nil
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return Arg{}, err
+		}
+		return StringArg(s), nil
+	}
+}
+
+func scalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (%T)", value, value)
+	}
+}
+
+// the --flag arguments for this value, empty if it should be omitted
+func (a Arg) Flags(name string) []string {
+	if a.Switch {
+		return []string{fmt.Sprintf("--%s", name)}
+	}
+	flags := []string{}
+	for _, value := range a.Values {
+		flags = append(flags, fmt.Sprintf("--%s=%s", name, value))
+	}
+	return flags
+}
+
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	arg, err := newArg(value)
+	if err != nil {
+		return err
+	}
+	*a = arg
+	return nil
+}
+
+func (a *Arg) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	arg, err := newArg(value)
+	if err != nil {
+		return err
+	}
+	*a = arg
+	return nil
+}
+
+type Args map[string]Arg
+
+// so errors can say which arg was wrong
+func (a *Args) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	args := Args{}
+	for name, value := range raw {
+		var arg Arg
+		if err := json.Unmarshal(value, &arg); err != nil {
+			return fmt.Errorf("args.%s: %s", name, err)
+		}
+		args[name] = arg
+	}
+	*a = args
+	return nil
+}
+
+// sorted, so bbl always sees its flags in the same order
+func (a Args) Names() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
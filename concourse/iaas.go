@@ -0,0 +1,40 @@
+package concourse
+
+type Azure struct {
+	ClientID       string `json:"client_id,omitempty" yaml:"client_id"`
+	ClientSecret   string `json:"client_secret,omitempty" yaml:"client_secret"`
+	TenantID       string `json:"tenant_id,omitempty" yaml:"tenant_id"`
+	SubscriptionID string `json:"subscription_id,omitempty" yaml:"subscription_id"`
+	Region         string `json:"region,omitempty" yaml:"region"`
+}
+
+type VSphere struct {
+	VCenterUser     string `json:"vcenter_user,omitempty" yaml:"vcenter_user"`
+	VCenterPassword string `json:"vcenter_password,omitempty" yaml:"vcenter_password"`
+	VCenterIP       string `json:"vcenter_ip,omitempty" yaml:"vcenter_ip"`
+	VCenterDC       string `json:"vcenter_dc,omitempty" yaml:"vcenter_dc"`
+	VCenterCluster  string `json:"vcenter_cluster,omitempty" yaml:"vcenter_cluster"`
+	VCenterRP       string `json:"vcenter_rp,omitempty" yaml:"vcenter_rp"`
+	VCenterDS       string `json:"vcenter_ds,omitempty" yaml:"vcenter_ds"`
+	Network         string `json:"network,omitempty" yaml:"network"`
+	SubnetCIDR      string `json:"subnet_cidr,omitempty" yaml:"subnet_cidr"`
+
+	VCenterDisks     string `json:"vcenter_disks,omitempty" yaml:"vcenter_disks"`
+	VCenterTemplates string `json:"vcenter_templates,omitempty" yaml:"vcenter_templates"`
+	VCenterVMs       string `json:"vcenter_vms,omitempty" yaml:"vcenter_vms"`
+}
+
+type OpenStack struct {
+	AuthURL     string `json:"auth_url,omitempty" yaml:"auth_url"`
+	AZ          string `json:"az,omitempty" yaml:"az"`
+	NetworkID   string `json:"network_id,omitempty" yaml:"network_id"`
+	NetworkName string `json:"network_name,omitempty" yaml:"network_name"`
+	Username    string `json:"username,omitempty" yaml:"username"`
+	Password    string `json:"password,omitempty" yaml:"password"`
+	Project     string `json:"project,omitempty" yaml:"project"`
+	Domain      string `json:"domain,omitempty" yaml:"domain"`
+
+	Region     string `json:"region,omitempty" yaml:"region"`
+	CACertFile string `json:"cacert_file,omitempty" yaml:"cacert_file"`
+	Insecure   bool   `json:"insecure,omitempty" yaml:"insecure"`
+}
@@ -0,0 +1,10 @@
+package concourse
+
+type InParams struct {
+	// only fetch the version, not the state
+	SkipDownload bool `json:"skip_download"`
+	// globs of the paths in the state to fetch, everything if empty
+	Files []string `json:"files"`
+	// write the environment's audit log alongside its state
+	AuditLog bool `json:"audit_log"`
+}
@@ -11,6 +11,7 @@ import (
 type InRequest struct {
 	Source  Source          `json:"source"`
 	Version storage.Version `json:"version"`
+	Params  InParams        `json:"params"`
 }
 
 func NewInRequest(request []byte) (InRequest, error) {
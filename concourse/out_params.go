@@ -11,23 +11,23 @@ package concourse
 //     Params: OutParams{
 //          Name: "some-env-name",
 //     		Command: "up",
-//          Args: map[string]string{"lb-cert": "----some cert----"},
+//          Args: Args{"lb-cert": StringArg("----some cert----"), "debug": BoolArg(true)},
 //     },
 // }
 // ```
 // will exec:
-// bbl -n up --iaas=gcp --name some-env-name --lb-cert=----some cert----
+// bbl -n up --debug --iaas=gcp --lb-cert=----some cert---- --name=some-env-name
 
 type OutParams struct {
-	Name        string                 `json:"name"`
-	NameFile    string                 `json:"name_file"`
-	StateDir    string                 `json:"state_dir"`
-	Command     string                 `json:"command"`
-	Args        map[string]interface{} `json:"args"`
-	PlanPatches []string               `json:"plan-patches"`
-}
-
-type UpArgs struct {
-	LBCert string `json:"lb-cert"`
-	LBKey  string `json:"lb-key"`
+	Name              string   `json:"name"`
+	NameFile          string   `json:"name_file"`
+	StateDir          string   `json:"state_dir"`
+	Command           string   `json:"command"`
+	Args              Args     `json:"args"`
+	ArgsFile          string   `json:"args_file"`
+	DryRun            bool     `json:"dry_run"`
+	Protected         *bool    `json:"protected"`
+	ConfirmName       string   `json:"confirm_name"`
+	AllowStateUpgrade bool     `json:"allow_state_upgrade"`
+	PlanPatches       []string `json:"plan-patches"`
 }
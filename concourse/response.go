@@ -0,0 +1,15 @@
+package concourse
+
+import "github.com/cloudfoundry/bbl-state-resource/storage"
+
+// what in and out print for concourse
+type Response struct {
+	Version  storage.Version `json:"version"`
+	Metadata []MetadataField `json:"metadata,omitempty"`
+}
+
+// shown alongside the version in the concourse ui
+type MetadataField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
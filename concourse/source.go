@@ -1,12 +1,153 @@
 package concourse
 
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/storage"
+)
+
 type Source struct {
 	Bucket string `json:"bucket,omitempty" yaml:"bucket"`
 	IAAS   string `json:"iaas,omitempty" yaml:"iaas"`
 
+	// only put creates the bucket, and only when asked to
+	CreateBucket bool `json:"create_bucket,omitempty" yaml:"create_bucket"`
+
 	LBType   string `json:"lb_type,omitempty" yaml:"lb_type"`
 	LBDomain string `json:"lb_domain,omitempty" yaml:"lb_domain"`
 
 	GCPServiceAccountKey string `json:"gcp_service_account_key,omitempty" yaml:"gcp_service_account_key"`
 	GCPRegion            string `json:"gcp_region,omitempty" yaml:"gcp_region"`
+
+	AWSAccessKeyID     string `json:"aws_access_key_id,omitempty" yaml:"aws_access_key_id"`
+	AWSSecretAccessKey string `json:"aws_secret_access_key,omitempty" yaml:"aws_secret_access_key"`
+	AWSRegion          string `json:"aws_region,omitempty" yaml:"aws_region"`
+	AWSAssumeRole      string `json:"aws_assume_role,omitempty" yaml:"aws_assume_role"`
+
+	Azure     *Azure     `json:"azure,omitempty" yaml:"azure"`
+	VSphere   *VSphere   `json:"vsphere,omitempty" yaml:"vsphere"`
+	OpenStack *OpenStack `json:"openstack,omitempty" yaml:"openstack"`
+
+	ContentAddressed bool   `json:"content_addressed,omitempty" yaml:"content_addressed"`
+	Retry            *Retry `json:"retry,omitempty" yaml:"retry"`
+	Spool            *Spool `json:"spool,omitempty" yaml:"spool"`
+
+	Timeouts *Timeouts `json:"timeouts,omitempty" yaml:"timeouts"`
+
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty" yaml:"checkpoint"`
+}
+
+type Checkpoint struct {
+	Disabled bool   `json:"disabled,omitempty" yaml:"disabled"`
+	Interval string `json:"interval,omitempty" yaml:"interval"`
+	Debounce string `json:"debounce,omitempty" yaml:"debounce"`
+}
+
+type Timeouts struct {
+	// bounds each individual storage call
+	Operation string `json:"operation,omitempty" yaml:"operation"`
+	// bounds the whole check, get or put
+	Overall string `json:"overall,omitempty" yaml:"overall"`
+	// how long bbl gets to save its state after a put is aborted
+	AbortGracePeriod string `json:"abort_grace_period,omitempty" yaml:"abort_grace_period"`
+}
+
+// where a put parks its state if the upload to Bucket fails.
+// exactly one of these should be set.
+type Spool struct {
+	Bucket string `json:"bucket,omitempty" yaml:"bucket"`
+	Dir    string `json:"dir,omitempty" yaml:"dir"`
+}
+
+type Retry struct {
+	Attempts       int     `json:"attempts,omitempty" yaml:"attempts"`
+	InitialBackoff string  `json:"initial_backoff,omitempty" yaml:"initial_backoff"`
+	MaxBackoff     string  `json:"max_backoff,omitempty" yaml:"max_backoff"`
+	Jitter         float64 `json:"jitter,omitempty" yaml:"jitter"`
+}
+
+func (s Source) StorageOptions() (storage.Options, error) {
+	opts := storage.Options{
+		ContentAddressed: s.ContentAddressed,
+		CreateBucket:     s.CreateBucket,
+	}
+	var err error
+
+	if s.Retry != nil {
+		initialBackoff, err := parseDuration("retry.initial_backoff", s.Retry.InitialBackoff)
+		if err != nil {
+			return storage.Options{}, err
+		}
+		maxBackoff, err := parseDuration("retry.max_backoff", s.Retry.MaxBackoff)
+		if err != nil {
+			return storage.Options{}, err
+		}
+		opts.Retry = storage.RetryPolicy{
+			Attempts:       s.Retry.Attempts,
+			InitialBackoff: initialBackoff,
+			MaxBackoff:     maxBackoff,
+			Jitter:         s.Retry.Jitter,
+		}
+	}
+
+	if s.Timeouts != nil {
+		opts.Retry.OperationTimeout, err = parseDuration("timeouts.operation", s.Timeouts.Operation)
+		if err != nil {
+			return storage.Options{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// zero means the runner's default
+func (s Source) AbortGracePeriod() (time.Duration, error) {
+	if s.Timeouts == nil {
+		return 0, nil
+	}
+	return parseDuration("timeouts.abort_grace_period", s.Timeouts.AbortGracePeriod)
+}
+
+// derives a context from parent that expires after the overall timeout, if there is one
+func (s Source) Context(parent context.Context) (context.Context, context.CancelFunc, error) {
+	if s.Timeouts == nil {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+
+	overall, err := parseDuration("timeouts.overall", s.Timeouts.Overall)
+	if err != nil {
+		return nil, nil, err
+	}
+	if overall == 0 {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithTimeout(parent, overall)
+	return ctx, cancel, nil
+}
+
+func (s Spool) Validate() error {
+	if s.Bucket != "" && s.Dir != "" {
+		return fmt.Errorf("spool: set only one of bucket or dir")
+	}
+	if s.Bucket == "" && s.Dir == "" {
+		return fmt.Errorf("spool: one of bucket or dir is required")
+	}
+	return nil
+}
+
+// empty durations are left zero so storage can pick its own default
+func parseDuration(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", field, err)
+	}
+	return d, nil
 }
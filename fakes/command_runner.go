@@ -1,11 +1,15 @@
 package fakes
 
+import "context"
+
 type CommandRunner struct {
 	RunCall struct {
 		CallCount int
 		Receives  struct {
+			Context context.Context
 			Command string
 			Args    []string
+			Env     []string
 		}
 		Returns struct {
 			Error error
@@ -13,9 +17,11 @@ type CommandRunner struct {
 	}
 }
 
-func (c *CommandRunner) Run(command string, args []string) error {
+func (c *CommandRunner) Run(ctx context.Context, command string, args []string, env []string) error {
 	c.RunCall.CallCount++
+	c.RunCall.Receives.Context = ctx
 	c.RunCall.Receives.Command = command
 	c.RunCall.Receives.Args = args
+	c.RunCall.Receives.Env = env
 	return c.RunCall.Returns.Error
 }
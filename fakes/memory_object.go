@@ -0,0 +1,66 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/storage"
+)
+
+// MemoryObject is a storage.Object that keeps its contents in memory,
+// for tests that need to read back what they wrote
+type MemoryObject struct {
+	Name     string
+	Contents []byte
+	Metadata map[string]string
+	Exists   bool
+
+	WriteCount int
+}
+
+func (m *MemoryObject) Version(ctx context.Context) (storage.Version, error) {
+	if !m.Exists {
+		return storage.Version{}, storage.ObjectNotFoundError
+	}
+	sum := md5.Sum(m.Contents)
+	return storage.Version{Name: m.Name, Ref: hex.EncodeToString(sum[:]), Updated: time.Unix(int64(m.WriteCount), 0), Metadata: m.Metadata}, nil
+}
+
+func (m *MemoryObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	if !m.Exists {
+		return nil, storage.ObjectNotFoundError
+	}
+	return ioutil.NopCloser(bytes.NewReader(m.Contents)), nil
+}
+
+func (m *MemoryObject) Delete(ctx context.Context) error {
+	if !m.Exists {
+		return storage.ObjectNotFoundError
+	}
+	m.Contents = nil
+	m.Exists = false
+	return nil
+}
+
+func (m *MemoryObject) NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser {
+	return &memoryWriter{object: m, metadata: metadata}
+}
+
+type memoryWriter struct {
+	bytes.Buffer
+	object   *MemoryObject
+	metadata map[string]string
+}
+
+func (w *memoryWriter) Close() error {
+	w.object.Contents = w.Bytes()
+	w.object.Metadata = w.metadata
+	w.object.Exists = true
+	w.object.WriteCount++
+	return nil
+}
@@ -19,6 +19,14 @@ type StateDir struct {
 		}
 	}
 
+	JumpboxHostKeyCall struct {
+		CallCount int
+		Returns   struct {
+			Key   string
+			Error error
+		}
+	}
+
 	PathCall struct {
 		CallCount int
 		Returns   struct {
@@ -37,6 +45,72 @@ type StateDir struct {
 		}
 	}
 
+	WriteBoshEnvCall struct {
+		CallCount int
+		Receives  struct {
+			Env outrunner.BoshEnv
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	CredhubCredentialsCall struct {
+		CallCount int
+		Returns   struct {
+			Credentials outrunner.CredhubCredentials
+			Error       error
+		}
+	}
+
+	WriteCredhubEnvCall struct {
+		CallCount int
+		Receives  struct {
+			Env outrunner.CredhubEnv
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	WriteSSHConfigCall struct {
+		CallCount int
+		Receives  struct {
+			Config outrunner.SSHConfig
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	TerraformOutputsCall struct {
+		CallCount int
+		Returns   struct {
+			Outputs outrunner.TerraformOutputs
+			Error   error
+		}
+	}
+
+	WriteTerraformOutputsCall struct {
+		CallCount int
+		Receives  struct {
+			Outputs outrunner.TerraformOutputs
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
+	WriteDNSRecordsCall struct {
+		CallCount int
+		Receives  struct {
+			Records []outrunner.DNSRecord
+		}
+		Returns struct {
+			Error error
+		}
+	}
+
 	ExpungeInteropFilesCall struct {
 		CallCount int
 		Returns   struct {
@@ -57,6 +131,12 @@ func (s *StateDir) JumpboxSSHKey() (string, error) {
 	return s.JumpboxSSHKeyCall.Returns.Key, s.JumpboxSSHKeyCall.Returns.Error
 }
 
+func (s *StateDir) JumpboxHostKey() (string, error) {
+	s.JumpboxHostKeyCall.CallCount++
+
+	return s.JumpboxHostKeyCall.Returns.Key, s.JumpboxHostKeyCall.Returns.Error
+}
+
 func (s *StateDir) Path() string {
 	s.PathCall.CallCount++
 
@@ -76,3 +156,50 @@ func (s *StateDir) WriteInteropFiles(name string, c outrunner.BoshDeploymentReso
 
 	return s.WriteInteropFilesCall.Returns.Error
 }
+
+func (s *StateDir) WriteBoshEnv(env outrunner.BoshEnv) error {
+	s.WriteBoshEnvCall.CallCount++
+	s.WriteBoshEnvCall.Receives.Env = env
+
+	return s.WriteBoshEnvCall.Returns.Error
+}
+
+func (s *StateDir) CredhubCredentials() (outrunner.CredhubCredentials, error) {
+	s.CredhubCredentialsCall.CallCount++
+
+	return s.CredhubCredentialsCall.Returns.Credentials, s.CredhubCredentialsCall.Returns.Error
+}
+
+func (s *StateDir) WriteCredhubEnv(env outrunner.CredhubEnv) error {
+	s.WriteCredhubEnvCall.CallCount++
+	s.WriteCredhubEnvCall.Receives.Env = env
+
+	return s.WriteCredhubEnvCall.Returns.Error
+}
+
+func (s *StateDir) WriteSSHConfig(config outrunner.SSHConfig) error {
+	s.WriteSSHConfigCall.CallCount++
+	s.WriteSSHConfigCall.Receives.Config = config
+
+	return s.WriteSSHConfigCall.Returns.Error
+}
+
+func (s *StateDir) TerraformOutputs() (outrunner.TerraformOutputs, error) {
+	s.TerraformOutputsCall.CallCount++
+
+	return s.TerraformOutputsCall.Returns.Outputs, s.TerraformOutputsCall.Returns.Error
+}
+
+func (s *StateDir) WriteTerraformOutputs(outputs outrunner.TerraformOutputs) error {
+	s.WriteTerraformOutputsCall.CallCount++
+	s.WriteTerraformOutputsCall.Receives.Outputs = outputs
+
+	return s.WriteTerraformOutputsCall.Returns.Error
+}
+
+func (s *StateDir) WriteDNSRecords(records []outrunner.DNSRecord) error {
+	s.WriteDNSRecordsCall.CallCount++
+	s.WriteDNSRecordsCall.Receives.Records = records
+
+	return s.WriteDNSRecordsCall.Returns.Error
+}
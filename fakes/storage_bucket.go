@@ -1,14 +1,35 @@
 package fakes
 
-import storage "github.com/cloudfoundry/bbl-state-resource/storage"
+import (
+	"context"
+	"strings"
+
+	storage "github.com/cloudfoundry/bbl-state-resource/storage"
+)
 
 type Bucket struct {
-	ObjectsCall struct {
+	ObjectCall struct {
+		CallCount int
+		Receives  struct {
+			Name string
+		}
 		Returns struct {
+			Objects map[string]storage.Object
+		}
+	}
+	ObjectsCall struct {
+		CallCount int
+		Returns   struct {
 			Objects []storage.Object
 			Error   error
 		}
 	}
+	ObjectsWithPrefixCall struct {
+		CallCount int
+		Receives  struct {
+			Prefix string
+		}
+	}
 	DeleteCall struct {
 		Returns struct {
 			Error error
@@ -16,10 +37,44 @@ type Bucket struct {
 	}
 }
 
-func (b *Bucket) GetAllObjects() ([]storage.Object, error) {
+// unknown names get a fresh, empty MemoryObject that is remembered for later calls
+func (b *Bucket) Object(name string) storage.Object {
+	b.ObjectCall.CallCount++
+	b.ObjectCall.Receives.Name = name
+	if b.ObjectCall.Returns.Objects == nil {
+		b.ObjectCall.Returns.Objects = map[string]storage.Object{}
+	}
+	object, ok := b.ObjectCall.Returns.Objects[name]
+	if !ok {
+		object = &MemoryObject{Name: name}
+		b.ObjectCall.Returns.Objects[name] = object
+	}
+	return object
+}
+
+func (b *Bucket) GetAllObjects(ctx context.Context) ([]storage.Object, error) {
+	b.ObjectsCall.CallCount++
 	return b.ObjectsCall.Returns.Objects, b.ObjectsCall.Returns.Error
 }
 
-func (b *Bucket) Delete() error {
+// the existing objects handed out by Object whose names start with prefix
+func (b *Bucket) GetObjectsWithPrefix(ctx context.Context, prefix string) ([]storage.Object, error) {
+	b.ObjectsWithPrefixCall.CallCount++
+	b.ObjectsWithPrefixCall.Receives.Prefix = prefix
+
+	var objects []storage.Object
+	for name, object := range b.ObjectCall.Returns.Objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := object.Version(ctx); err == storage.ObjectNotFoundError {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func (b *Bucket) Delete(ctx context.Context) error {
 	return b.DeleteCall.Returns.Error
 }
@@ -1,6 +1,7 @@
 package fakes
 
 import (
+	"context"
 	"io"
 
 	"github.com/cloudfoundry/bbl-state-resource/storage"
@@ -8,7 +9,8 @@ import (
 
 type Object struct {
 	VersionCall struct {
-		Returns struct {
+		CallCount int
+		Returns   struct {
 			Version storage.Version
 			Error   error
 		}
@@ -22,24 +24,41 @@ type Object struct {
 		}
 	}
 
-	NewWriterCall struct {
+	DeleteCall struct {
 		CallCount int
 		Returns   struct {
+			Error error
+		}
+	}
+
+	NewWriterCall struct {
+		CallCount int
+		Receives  struct {
+			Metadata map[string]string
+		}
+		Returns struct {
 			WriteCloser io.WriteCloser
 		}
 	}
 }
 
-func (g *Object) Version() (storage.Version, error) {
+func (g *Object) Version(ctx context.Context) (storage.Version, error) {
+	g.VersionCall.CallCount++
 	return g.VersionCall.Returns.Version, g.VersionCall.Returns.Error
 }
 
-func (g *Object) NewReader() (io.ReadCloser, error) {
+func (g *Object) NewReader(ctx context.Context) (io.ReadCloser, error) {
 	g.NewReaderCall.CallCount++
 	return g.NewReaderCall.Returns.ReadCloser, g.NewReaderCall.Returns.Error
 }
 
-func (g *Object) NewWriter() io.WriteCloser {
+func (g *Object) NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser {
 	g.NewWriterCall.CallCount++
+	g.NewWriterCall.Receives.Metadata = metadata
 	return g.NewWriterCall.Returns.WriteCloser
 }
+
+func (g *Object) Delete(ctx context.Context) error {
+	g.DeleteCall.CallCount++
+	return g.DeleteCall.Returns.Error
+}
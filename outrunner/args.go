@@ -0,0 +1,88 @@
+package outrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const fileArgSuffix = "_file"
+
+// flags bbl reads a file from, rather than taking the value itself
+var pathFlags = map[string]bool{
+	"lb-cert":  true,
+	"lb-key":   true,
+	"lb-chain": true,
+}
+
+// Params.Args > Params.ArgsFile, with `<flag>` and `<flag>_file` overriding
+// each other, then every `<flag>_file` arg is replaced by `<flag>` set to the
+// contents of that file, or for pathFlags to the file's full path, since bbl
+// runs from somewhere else.
+// files are relative to sourcesDir, like Params.NameFile
+func Args(sourcesDir string, params concourse.OutParams) (concourse.Args, error) {
+	args := concourse.Args{}
+
+	if params.ArgsFile != "" {
+		contents, err := ioutil.ReadFile(filepath.Join(sourcesDir, params.ArgsFile))
+		if err != nil {
+			return nil, fmt.Errorf("Failure reading args file: %s", err)
+		}
+		err = yaml.Unmarshal(contents, &args)
+		if err != nil {
+			return nil, fmt.Errorf("Failure parsing args file %s: %s", params.ArgsFile, err)
+		}
+	}
+
+	for name := range params.Args {
+		// <flag> and <flag>_file are the same arg, so either one in params overrides both in the file
+		if strings.HasSuffix(name, fileArgSuffix) {
+			delete(args, strings.TrimSuffix(name, fileArgSuffix))
+		} else {
+			delete(args, name+fileArgSuffix)
+		}
+	}
+	for name, value := range params.Args {
+		args[name] = value
+	}
+
+	for _, name := range args.Names() {
+		if !strings.HasSuffix(name, fileArgSuffix) {
+			continue
+		}
+
+		flag := strings.TrimSuffix(name, fileArgSuffix)
+		if _, ok := args[flag]; ok {
+			return nil, fmt.Errorf("both %s and %s were provided, use one or the other", flag, name)
+		}
+
+		value := args[name]
+		if value.Switch || len(value.Values) != 1 {
+			return nil, fmt.Errorf("%s must be a single path", name)
+		}
+
+		path := filepath.Join(sourcesDir, value.Values[0])
+		delete(args, name)
+
+		if pathFlags[flag] {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("Failure reading %s: %s", name, err)
+			}
+			args[flag] = concourse.StringArg(path)
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failure reading %s: %s", name, err)
+		}
+		args[flag] = concourse.StringArg(strings.TrimSpace(string(contents)))
+	}
+
+	return args, nil
+}
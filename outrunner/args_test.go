@@ -0,0 +1,133 @@
+package outrunner_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Args", func() {
+	var sourcesDir string
+
+	BeforeEach(func() {
+		var err error
+		sourcesDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.MkdirAll(filepath.Join(sourcesDir, "certs"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(sourcesDir, "certs", "cert.pem"), []byte("----some cert----\n"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(sourcesDir, "domain"), []byte("file.example.com\n"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(sourcesDir, "args.yml"), []byte(`
+lb-type: cf
+lb-domain: file.example.com
+lb-cert_file: certs/cert.pem
+debug: true
+`), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(sourcesDir)
+	})
+
+	It("returns params.args as they are", func() {
+		args, err := outrunner.Args(sourcesDir, concourse.OutParams{
+			Args: concourse.Args{"lb-type": concourse.StringArg("cf")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal(concourse.Args{"lb-type": concourse.StringArg("cf")}))
+	})
+
+	It("loads args from the args file, letting params.args win", func() {
+		args, err := outrunner.Args(sourcesDir, concourse.OutParams{
+			ArgsFile: "args.yml",
+			Args:     concourse.Args{"lb-domain": concourse.StringArg("params.example.com")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal(concourse.Args{
+			"lb-type":   concourse.StringArg("cf"),
+			"lb-domain": concourse.StringArg("params.example.com"),
+			"lb-cert":   concourse.StringArg(filepath.Join(sourcesDir, "certs", "cert.pem")),
+			"debug":     concourse.BoolArg(true),
+		}))
+	})
+
+	It("lets a _file arg in params.args override the same flag in the args file, and the other way round", func() {
+		err := ioutil.WriteFile(filepath.Join(sourcesDir, "other-domain"), []byte("other.example.com\n"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		args, err := outrunner.Args(sourcesDir, concourse.OutParams{
+			ArgsFile: "args.yml",
+			Args:     concourse.Args{"lb-domain_file": concourse.StringArg("other-domain")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(HaveKeyWithValue("lb-domain", concourse.StringArg("other.example.com")))
+		Expect(args).NotTo(HaveKey("lb-domain_file"))
+
+		args, err = outrunner.Args(sourcesDir, concourse.OutParams{
+			ArgsFile: "args.yml",
+			Args:     concourse.Args{"lb-cert": concourse.StringArg("/some/other/cert.pem")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(HaveKeyWithValue("lb-cert", concourse.StringArg("/some/other/cert.pem")))
+		Expect(args).NotTo(HaveKey("lb-cert_file"))
+	})
+
+	It("replaces _file args with the contents of the file", func() {
+		args, err := outrunner.Args(sourcesDir, concourse.OutParams{
+			Args: concourse.Args{"lb-domain_file": concourse.StringArg("domain")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal(concourse.Args{"lb-domain": concourse.StringArg("file.example.com")}))
+	})
+
+	It("replaces _file args for flags bbl reads a file from with the file's full path", func() {
+		args, err := outrunner.Args(sourcesDir, concourse.OutParams{
+			Args: concourse.Args{"lb-cert_file": concourse.StringArg("certs/cert.pem")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal(concourse.Args{"lb-cert": concourse.StringArg(filepath.Join(sourcesDir, "certs", "cert.pem"))}))
+	})
+
+	Context("failure", func() {
+		It("errors when the args file is missing or malformed", func() {
+			_, err := outrunner.Args(sourcesDir, concourse.OutParams{ArgsFile: "not-a-real-file"})
+			Expect(err).To(MatchError(ContainSubstring("Failure reading args file")))
+
+			err = ioutil.WriteFile(filepath.Join(sourcesDir, "bad.yml"), []byte("lb-cert: {nested: map}"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = outrunner.Args(sourcesDir, concourse.OutParams{ArgsFile: "bad.yml"})
+			Expect(err).To(MatchError(ContainSubstring("Failure parsing args file bad.yml")))
+		})
+
+		It("errors when a _file arg points at a missing file", func() {
+			_, err := outrunner.Args(sourcesDir, concourse.OutParams{
+				Args: concourse.Args{"lb-key_file": concourse.StringArg("certs/key.pem")},
+			})
+			Expect(err).To(MatchError(ContainSubstring("Failure reading lb-key_file")))
+
+			_, err = outrunner.Args(sourcesDir, concourse.OutParams{
+				Args: concourse.Args{"lb-domain_file": concourse.StringArg("not-a-real-file")},
+			})
+			Expect(err).To(MatchError(ContainSubstring("Failure reading lb-domain_file")))
+		})
+
+		It("errors when a flag is given both directly and as a file", func() {
+			_, err := outrunner.Args(sourcesDir, concourse.OutParams{
+				Args: concourse.Args{
+					"lb-cert":      concourse.StringArg("----another cert----"),
+					"lb-cert_file": concourse.StringArg("certs/cert.pem"),
+				},
+			})
+			Expect(err).To(MatchError("both lb-cert and lb-cert_file were provided, use one or the other"))
+		})
+	})
+})
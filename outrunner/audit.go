@@ -0,0 +1,103 @@
+package outrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+const (
+	// the record kind audit records are stored under
+	AuditRecordKind = "audit"
+	// where get writes the audit log, one record per line
+	AuditLogFile = "audit.jsonl"
+)
+
+// what a single put did to an environment
+type AuditRecord struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	PlanPatches []string          `json:"plan_patches"`
+	BBLVersion  string            `json:"bbl_version"`
+	ExitStatus  int               `json:"exit_status"`
+	Error       string            `json:"error,omitempty"`
+	StartedAt   time.Time         `json:"started_at"`
+	Duration    string            `json:"duration"`
+	BeforeRef   string            `json:"before_ref"`
+	AfterRef    string            `json:"after_ref"`
+	Build       map[string]string `json:"build"`
+}
+
+// duration is how long bbl ran for, not counting the upload afterwards
+func NewAuditRecord(command Command, flags concourse.Args, planPatches []string, bblVersion string, startedAt time.Time, duration time.Duration, bblError error) AuditRecord {
+	record := AuditRecord{
+		Command:     command.Name,
+		Args:        SanitizeArgs(flags),
+		PlanPatches: planPatches,
+		BBLVersion:  bblVersion,
+		ExitStatus:  exitStatus(bblError),
+		StartedAt:   startedAt.UTC(),
+		Duration:    duration.Round(time.Second).String(),
+		Build:       BuildMetadata(),
+	}
+	if bblError != nil {
+		record.Error = bblError.Error()
+	}
+	return record
+}
+
+// flags as bbl sees them, with the sensitive ones redacted
+func SanitizeArgs(flags concourse.Args) []string {
+	args := []string{}
+	for _, name := range flags.Names() {
+		if IsSensitiveFlag(name) {
+			args = append(args, fmt.Sprintf("--%s=<redacted>", name))
+			continue
+		}
+		args = append(args, flags[name].Flags(name)...)
+	}
+	return args
+}
+
+// -1 when bbl didn't get as far as exiting
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// the BUILD_* variables, and the concourse url, concourse gives puts
+func BuildMetadata() map[string]string {
+	build := map[string]string{}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if strings.HasPrefix(parts[0], "BUILD_") || parts[0] == "ATC_EXTERNAL_URL" {
+			build[parts[0]] = parts[1]
+		}
+	}
+	return build
+}
+
+// the audit log as written by get, one compacted record per line
+func AuditLog(records [][]byte) ([]byte, error) {
+	var log bytes.Buffer
+	for _, record := range records {
+		if err := json.Compact(&log, record); err != nil {
+			return nil, err
+		}
+		log.WriteByte('\n')
+	}
+	return log.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+package outrunner_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	var flags concourse.Args
+
+	BeforeEach(func() {
+		flags = concourse.Args{
+			"iaas":                    concourse.StringArg("gcp"),
+			"gcp-service-account-key": concourse.StringArg("some-private-key"),
+			"aws-secret-access-key":   concourse.StringArg("some-secret-access-key"),
+			"debug":                   concourse.BoolArg(true),
+		}
+		os.Setenv("BUILD_PIPELINE_NAME", "some-pipeline")
+		os.Setenv("BUILD_JOB_NAME", "some-job")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("BUILD_PIPELINE_NAME")
+		os.Unsetenv("BUILD_JOB_NAME")
+	})
+
+	Describe("NewAuditRecord", func() {
+		It("records the put without its secrets", func() {
+			startedAt := time.Now().Add(-time.Hour)
+			record := outrunner.NewAuditRecord(outrunner.Commands["up"], flags, []string{"plan-patches/bosh-lite"}, "bbl 8.4.92", startedAt, time.Minute, nil)
+
+			Expect(record.Command).To(Equal("up"))
+			Expect(record.Args).To(Equal([]string{
+				"--aws-secret-access-key=<redacted>",
+				"--debug",
+				"--gcp-service-account-key=<redacted>",
+				"--iaas=gcp",
+			}))
+			Expect(record.PlanPatches).To(Equal([]string{"plan-patches/bosh-lite"}))
+			Expect(record.BBLVersion).To(Equal("bbl 8.4.92"))
+			Expect(record.ExitStatus).To(Equal(0))
+			Expect(record.Error).To(BeEmpty())
+			Expect(record.StartedAt).To(Equal(startedAt.UTC()))
+			Expect(record.Duration).To(Equal("1m0s"))
+			Expect(record.Build).To(HaveKeyWithValue("BUILD_PIPELINE_NAME", "some-pipeline"))
+			Expect(record.Build).To(HaveKeyWithValue("BUILD_JOB_NAME", "some-job"))
+
+			contents, err := json.Marshal(record)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).NotTo(ContainSubstring("some-private-key"))
+			Expect(string(contents)).NotTo(ContainSubstring("some-secret-access-key"))
+		})
+
+		It("records bbl's exit status", func() {
+			exitErr := exec.Command("sh", "-c", "exit 3").Run()
+			Expect(exitErr).To(HaveOccurred())
+
+			record := outrunner.NewAuditRecord(outrunner.Commands["down"], flags, nil, "unknown", time.Now(), time.Second, exitErr)
+			Expect(record.ExitStatus).To(Equal(3))
+			Expect(record.Error).To(Equal("exit status 3"))
+
+			record = outrunner.NewAuditRecord(outrunner.Commands["down"], flags, nil, "unknown", time.Now(), time.Second, errors.New("aborted"))
+			Expect(record.ExitStatus).To(Equal(-1))
+		})
+	})
+
+	Describe("AuditLog", func() {
+		It("writes one record per line", func() {
+			log, err := outrunner.AuditLog([][]byte{
+				[]byte("{\n  \"command\": \"up\"\n}"),
+				[]byte(`{"command": "down"}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(log)).To(Equal("{\"command\":\"up\"}\n{\"command\":\"down\"}\n"))
+		})
+	})
+})
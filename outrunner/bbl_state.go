@@ -1,18 +1,166 @@
 package outrunner
 
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// the bbl-state.json schema version written by the bbl the Dockerfile bundles.
+// bump it along with bbl_version whenever bbl changes its schema
+const StateVersion = 14
+
+// bbl-state.json, as bbl 8 writes it. credentials bbl is given on every run,
+// rather than storing, never appear in it.
 type BblState struct {
+	Version    int    `json:"version"`
+	BBLVersion string `json:"bblVersion"`
+	IAAS       string `json:"iaas"`
+	ID         string `json:"id"`
+	EnvID      string `json:"envID"`
+
+	AWS        AWS        `json:"aws"`
+	Azure      Azure      `json:"azure"`
+	CloudStack CloudStack `json:"cloudstack"`
+	GCP        GCP        `json:"gcp"`
+	VSphere    VSphere    `json:"vsphere"`
+	OpenStack  OpenStack  `json:"openstack"`
+
 	Jumpbox  Jumpbox  `json:"jumpbox"`
 	Director Director `json:"bosh"`
-	EnvID    string   `json:"envID"`
+
+	TFState        string `json:"tfState"`
+	LB             LB     `json:"lb"`
+	LatestTFOutput string `json:"latestTFOutput"`
+	NoDirector     bool   `json:"noDirector"`
+
+	MigratedFromCloudFormation bool `json:"migratedFromCloudFormation"`
+
+	// fields from a newer bbl than this model, kept so a state survives a round trip
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type AWS struct {
+	Region string `json:"region,omitempty"`
 }
 
+type Azure struct {
+	Region string `json:"region,omitempty"`
+}
+
+type CloudStack struct{}
+
+type GCP struct {
+	Zone   string   `json:"zone,omitempty"`
+	Region string   `json:"region,omitempty"`
+	Zones  []string `json:"zones,omitempty"`
+}
+
+type VSphere struct{}
+
+type OpenStack struct{}
+
 type Jumpbox struct {
-	URL string `json:"url"`
+	URL       string          `json:"url"`
+	Variables string          `json:"variables,omitempty"`
+	Manifest  string          `json:"manifest,omitempty"`
+	State     json.RawMessage `json:"state,omitempty"`
 }
 
 type Director struct {
-	ClientUsername string `json:"directorUsername"`
-	ClientSecret   string `json:"directorPassword"`
-	Address        string `json:"directorAddress"`
-	CaCert         string `json:"directorSSLCA"`
+	Name           string          `json:"directorName"`
+	ClientUsername string          `json:"directorUsername"`
+	ClientSecret   string          `json:"directorPassword"`
+	Address        string          `json:"directorAddress"`
+	CaCert         string          `json:"directorSSLCA"`
+	SSLCertificate string          `json:"directorSSLCertificate"`
+	SSLPrivateKey  string          `json:"directorSSLPrivateKey"`
+	Variables      string          `json:"variables,omitempty"`
+	State          json.RawMessage `json:"state,omitempty"`
+	Manifest       string          `json:"manifest,omitempty"`
+	UserOpsFile    string          `json:"userOpsFile"`
+}
+
+type LB struct {
+	Type   string `json:"type"`
+	Cert   string `json:"cert"`
+	Key    string `json:"key"`
+	Chain  string `json:"chain"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// empty for iaases bbl doesn't record a region for
+func (s BblState) Region() string {
+	switch s.IAAS {
+	case "aws":
+		return s.AWS.Region
+	case "azure":
+		return s.Azure.Region
+	case "gcp":
+		return s.GCP.Region
+	}
+	return ""
+}
+
+// false for environments brought up with --no-director, and before bbl up has created one
+func (s BblState) HasDirector() bool {
+	return !s.NoDirector && s.Director.Address != ""
+}
+
+// BblState without its json methods
+type bblState BblState
+
+var bblStateFields = jsonFieldNames(reflect.TypeOf(bblState{}))
+
+func (s *BblState) UnmarshalJSON(data []byte) error {
+	var known bblState
+	err := json.Unmarshal(data, &known)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	for name := range bblStateFields {
+		delete(fields, name)
+	}
+	if len(fields) > 0 {
+		known.Extra = fields
+	}
+
+	*s = BblState(known)
+	return nil
+}
+
+func (s BblState) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal(bblState(s))
+	if err != nil || len(s.Extra) == 0 {
+		return known, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(known, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range s.Extra {
+		if !bblStateFields[name] {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
 }
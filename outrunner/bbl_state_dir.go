@@ -131,21 +131,34 @@ func (b StateDir) ApplyPlanPatches(patchPaths []string) error {
 	return nil
 }
 
-func (b StateDir) JumpboxSSHKey() (string, error) {
+type jumpboxVarsStore struct {
+	JumpboxSSH struct {
+		PrivateKey string `yaml:"private_key"`
+	} `yaml:"jumpbox_ssh"`
+	JumpboxHostKey struct {
+		PublicKey string `yaml:"public_key"`
+	} `yaml:"jumpbox_host_key"`
+}
+
+func (b StateDir) readJumpboxVarsStore() (jumpboxVarsStore, error) {
 	path := filepath.Join(b.dir, "vars", "jumpbox-vars-store.yml")
 
 	contents, err := ioutil.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("Read jumpbox vars store: %s", err)
+		return jumpboxVarsStore{}, fmt.Errorf("Read jumpbox vars store: %s", err)
 	}
 
-	var p struct {
-		JumpboxSSH struct {
-			PrivateKey string `yaml:"private_key"`
-		} `yaml:"jumpbox_ssh"`
+	var p jumpboxVarsStore
+	err = yaml.Unmarshal(contents, &p)
+	if err != nil {
+		return jumpboxVarsStore{}, err
 	}
 
-	err = yaml.Unmarshal(contents, &p)
+	return p, nil
+}
+
+func (b StateDir) JumpboxSSHKey() (string, error) {
+	p, err := b.readJumpboxVarsStore()
 	if err != nil {
 		return "", err
 	}
@@ -153,6 +166,16 @@ func (b StateDir) JumpboxSSHKey() (string, error) {
 	return p.JumpboxSSH.PrivateKey, nil
 }
 
+// empty if the jumpbox was deployed without a host key in its vars store
+func (b StateDir) JumpboxHostKey() (string, error) {
+	p, err := b.readJumpboxVarsStore()
+	if err != nil {
+		return "", err
+	}
+
+	return p.JumpboxHostKey.PublicKey, nil
+}
+
 type BoshDeploymentResourceConfig struct {
 	Target          string `yaml:"target"`
 	Client          string `yaml:"client"`
@@ -163,9 +186,11 @@ type BoshDeploymentResourceConfig struct {
 	JumpboxUsername string `yaml:"jumpbox_username"`
 }
 
+// what SyncInteropFiles generates from the state, at the top of the state dir
+var InteropFiles = []string{"name", "metadata", "bdr-source-file", BoshEnvScriptFile, BoshEnvJSONFile, CredhubEnvScriptFile, CredhubJSONFile, SSHConfigFile, KnownHostsFile, JumpboxPrivateKeyFile, TerraformOutputsFile, TerraformVarsFile, DNSRecordsFile}
+
 func (b StateDir) ExpungeInteropFiles() error {
-	files := []string{"name", "metadata", "bdr-source-file"}
-	for _, filename := range files {
+	for _, filename := range InteropFiles {
 		err := os.Remove(filepath.Join(b.dir, filename))
 		if !os.IsNotExist(err) && err != nil {
 			return err
@@ -189,3 +214,145 @@ func (b StateDir) WriteInteropFiles(name string, c BoshDeploymentResourceConfig)
 	}
 	return ioutil.WriteFile(filepath.Join(b.dir, "metadata"), []byte(bytes), os.ModePerm)
 }
+
+func (b StateDir) CredhubCredentials() (CredhubCredentials, error) {
+	path := filepath.Join(b.dir, "vars", "director-vars-store.yml")
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return CredhubCredentials{}, fmt.Errorf("Read director vars store: %s", err)
+	}
+
+	var creds CredhubCredentials
+	err = yaml.Unmarshal(contents, &creds)
+	if err != nil {
+		return CredhubCredentials{}, err
+	}
+
+	return creds, nil
+}
+
+// from vars/terraform.tfstate, or from bbl-state.json for bbls that embedded it there
+func (b StateDir) TerraformOutputs() (TerraformOutputs, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(b.dir, "vars", "terraform.tfstate"))
+	if os.IsNotExist(err) {
+		state, err := b.Read()
+		if err != nil {
+			return nil, err
+		}
+		contents = []byte(state.TFState)
+	} else if err != nil {
+		return nil, fmt.Errorf("Read terraform state: %s", err)
+	}
+
+	return ParseTerraformOutputs(contents)
+}
+
+// removes stale files when there are no outputs, e.g. before terraform has run, or once it's destroyed everything
+func (b StateDir) WriteTerraformOutputs(outputs TerraformOutputs) error {
+	if len(outputs) == 0 {
+		for _, file := range []string{TerraformOutputsFile, TerraformVarsFile} {
+			err := os.Remove(filepath.Join(b.dir, file))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	bytes, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(b.dir, TerraformOutputsFile), bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	bytes, err = yaml.Marshal(outputs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(b.dir, TerraformVarsFile), bytes, 0644)
+}
+
+// removes a stale file when there are no records, e.g. once the lb is gone
+func (b StateDir) WriteDNSRecords(records []DNSRecord) error {
+	path := filepath.Join(b.dir, DNSRecordsFile)
+	if len(records) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	bytes, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+func (b StateDir) WriteBoshEnv(env BoshEnv) error {
+	return b.writeEnvScript(BoshEnvScriptFile, BoshEnvJSONFile, env.envScript())
+}
+
+func (b StateDir) WriteCredhubEnv(env CredhubEnv) error {
+	return b.writeEnvScript(CredhubEnvScriptFile, CredhubJSONFile, env.envScript())
+}
+
+func (b StateDir) WriteSSHConfig(config SSHConfig) error {
+	err := b.writeJumpboxKey(config.JumpboxSSHKey)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(b.dir, SSHConfigFile), []byte(config.Config()), 0644)
+	if err != nil {
+		return err
+	}
+
+	knownHosts := filepath.Join(b.dir, KnownHostsFile)
+	if config.HostKey == "" {
+		err = os.Remove(knownHosts) // don't leave a stale one from a previous jumpbox
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(knownHosts, []byte(config.KnownHosts()), 0644)
+}
+
+func (b StateDir) writeEnvScript(scriptFile, jsonFile string, env envScript) error {
+	if env.proxied() {
+		err := b.writeJumpboxKey(env.jumpboxSSHKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	// both carry the client secret
+	err := writePrivateFile(filepath.Join(b.dir, scriptFile), []byte(env.script()))
+	if err != nil {
+		return err
+	}
+	bytes, err := env.json()
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(filepath.Join(b.dir, jsonFile), bytes)
+}
+
+func (b StateDir) writeJumpboxKey(key string) error {
+	return writePrivateFile(filepath.Join(b.dir, JumpboxPrivateKeyFile), []byte(key))
+}
+
+func writePrivateFile(path string, contents []byte) error {
+	err := ioutil.WriteFile(path, contents, 0600)
+	if err != nil {
+		return err
+	}
+	// WriteFile leaves the mode of an existing file alone
+	return os.Chmod(path, 0600)
+}
@@ -1,6 +1,7 @@
 package outrunner_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -26,6 +27,17 @@ jumpbox_ssh:
   private_key: da-key
 `
 
+const sampleDirectorVarsStore = `
+admin_password: some-admin-password
+credhub_admin_client_secret: some-credhub-secret
+credhub_tls:
+  ca: credhub-ca
+  certificate: credhub-cert
+  private_key: credhub-key
+uaa_ssl:
+  ca: uaa-ca
+`
+
 const sampleMetadata = `target: target
 client: da-client
 client_secret: da-secret
@@ -168,6 +180,75 @@ var _ = Describe("StateDir", func() {
 
 			Expect(key).To(Equal("da-key"))
 		})
+
+		It("returns no host key when the vars store has none", func() {
+			key, err := stateDir.JumpboxHostKey()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(key).To(BeEmpty())
+		})
+
+		It("returns the jumpbox host key when there is one", func() {
+			varsStore := filepath.Join(tmpDir, "vars", "jumpbox-vars-store.yml")
+			err := ioutil.WriteFile(varsStore, []byte(sampleJumpboxVarsStore+"jumpbox_host_key:\n  public_key: ssh-rsa da-host-key\n"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			key, err := stateDir.JumpboxHostKey()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(key).To(Equal("ssh-rsa da-host-key"))
+		})
+	})
+
+	Describe("CredhubCredentials", func() {
+		It("reads credhub's credentials from the director vars store", func() {
+			err := os.Mkdir(filepath.Join(tmpDir, "vars"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(tmpDir, "vars", "director-vars-store.yml"), []byte(sampleDirectorVarsStore), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			creds, err := stateDir.CredhubCredentials()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(creds.ClientSecret).To(Equal("some-credhub-secret"))
+			Expect(creds.TLS.CA).To(Equal("credhub-ca"))
+			Expect(creds.UAASSL.CA).To(Equal("uaa-ca"))
+		})
+
+		It("errors without a director vars store", func() {
+			_, err := stateDir.CredhubCredentials()
+			Expect(err).To(MatchError(ContainSubstring("Read director vars store")))
+		})
+	})
+
+	Describe("TerraformOutputs", func() {
+		It("reads the outputs from vars/terraform.tfstate", func() {
+			err := os.Mkdir(filepath.Join(tmpDir, "vars"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(tmpDir, "vars", "terraform.tfstate"), []byte(sampleTerraformStateV4), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			outputs, err := stateDir.TerraformOutputs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outputs).To(HaveKeyWithValue("network_name", "some-env-network"))
+		})
+
+		It("falls back to the terraform state embedded in bbl-state.json", func() {
+			state, err := json.Marshal(map[string]string{"tfState": sampleTerraformStateV3})
+			Expect(err).NotTo(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(tmpDir, "bbl-state.json"), state, os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			outputs, err := stateDir.TerraformOutputs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outputs).To(Equal(outrunner.TerraformOutputs{"network_name": "some-env-network"}))
+		})
+
+		It("has no outputs before terraform has run", func() {
+			outputs, err := stateDir.TerraformOutputs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outputs).To(BeEmpty())
+		})
 	})
 
 	Describe("InteropFiles", func() {
@@ -212,11 +293,215 @@ with two lines`,
 			})
 		})
 
+		Describe("WriteBoshEnv", func() {
+			var env outrunner.BoshEnv
+			BeforeEach(func() {
+				env = outrunner.BoshEnv{
+					Environment:   "https://10.0.0.6:25555",
+					JumpboxURL:    "35.1.2.3:22",
+					JumpboxSSHKey: "da-key",
+				}
+			})
+
+			It("writes the script, its json equivalent and a private jumpbox key", func() {
+				err := stateDir.WriteBoshEnv(env)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "bosh-env.sh"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(env.Script()))
+
+				contents, err = ioutil.ReadFile(filepath.Join(tmpDir, "bosh-env.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`"BOSH_ENVIRONMENT": "https://10.0.0.6:25555"`))
+
+				contents, err = ioutil.ReadFile(filepath.Join(tmpDir, "jumpbox-private.key"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("da-key"))
+			})
+
+			It("keeps the jumpbox key and the files with the client secret private, even if they were already there", func() {
+				for _, file := range []string{"jumpbox-private.key", "bosh-env.sh", "bosh-env.json"} {
+					err := ioutil.WriteFile(filepath.Join(tmpDir, file), []byte("old"), 0644)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				err := stateDir.WriteBoshEnv(env)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, file := range []string{"jumpbox-private.key", "bosh-env.sh", "bosh-env.json"} {
+					info, err := os.Stat(filepath.Join(tmpDir, file))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)), file)
+				}
+			})
+
+			It("doesn't write a key when there's no jumpbox", func() {
+				env.JumpboxURL = ""
+
+				err := stateDir.WriteBoshEnv(env)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(tmpDir, "jumpbox-private.key"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("WriteCredhubEnv", func() {
+			It("writes the script, its json equivalent and the jumpbox key it proxies with", func() {
+				env := outrunner.CredhubEnv{
+					Server:        "https://10.0.0.6:8844",
+					JumpboxURL:    "35.1.2.3:22",
+					JumpboxSSHKey: "da-key",
+				}
+				err := stateDir.WriteCredhubEnv(env)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "credhub-env.sh"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(env.Script()))
+
+				contents, err = ioutil.ReadFile(filepath.Join(tmpDir, "credhub.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`"CREDHUB_SERVER": "https://10.0.0.6:8844"`))
+
+				for _, file := range []string{"jumpbox-private.key", "credhub-env.sh", "credhub.json"} {
+					info, err := os.Stat(filepath.Join(tmpDir, file))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)), file)
+				}
+			})
+
+			It("keeps the files with the client secret private even if they were already there", func() {
+				for _, file := range []string{"credhub-env.sh", "credhub.json"} {
+					err := ioutil.WriteFile(filepath.Join(tmpDir, file), []byte("old"), 0644)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				err := stateDir.WriteCredhubEnv(outrunner.CredhubEnv{Server: "https://10.0.0.6:8844"})
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, file := range []string{"credhub-env.sh", "credhub.json"} {
+					info, err := os.Stat(filepath.Join(tmpDir, file))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)), file)
+				}
+			})
+		})
+
+		Describe("WriteSSHConfig", func() {
+			var config outrunner.SSHConfig
+			BeforeEach(func() {
+				config = outrunner.SSHConfig{
+					JumpboxURL:    "35.1.2.3:22",
+					JumpboxSSHKey: "da-key",
+					HostKey:       "ssh-rsa da-host-key",
+				}
+			})
+
+			It("writes the ssh config, known_hosts and a private jumpbox key", func() {
+				err := stateDir.WriteSSHConfig(config)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "ssh_config"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(config.Config()))
+
+				contents, err = ioutil.ReadFile(filepath.Join(tmpDir, "known_hosts"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("35.1.2.3 ssh-rsa da-host-key\n"))
+
+				info, err := os.Stat(filepath.Join(tmpDir, "jumpbox-private.key"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			})
+
+			It("removes a stale known_hosts when there's no host key", func() {
+				err := stateDir.WriteSSHConfig(config)
+				Expect(err).NotTo(HaveOccurred())
+
+				config.HostKey = ""
+				err = stateDir.WriteSSHConfig(config)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(tmpDir, "known_hosts"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("WriteTerraformOutputs", func() {
+			It("writes the outputs as json, and as yaml for bosh -l", func() {
+				err := stateDir.WriteTerraformOutputs(outrunner.TerraformOutputs{
+					"network_name": "some-env-network",
+					"zones":        []interface{}{"z1", "z2"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "terraform-outputs.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(MatchJSON(`{"network_name": "some-env-network", "zones": ["z1", "z2"]}`))
+
+				contents, err = ioutil.ReadFile(filepath.Join(tmpDir, "vars.yml"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("network_name: some-env-network\nzones:\n- z1\n- z2\n"))
+			})
+
+			It("removes stale files when there are no outputs", func() {
+				err := stateDir.WriteTerraformOutputs(outrunner.TerraformOutputs{"network_name": "some-env-network"})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = stateDir.WriteTerraformOutputs(outrunner.TerraformOutputs{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(tmpDir, "terraform-outputs.json")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(tmpDir, "vars.yml")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Describe("WriteDNSRecords", func() {
+			records := []outrunner.DNSRecord{{Domain: "*.cf.example.com", Type: "A", Value: "35.1.2.3"}}
+
+			It("writes the records as json", func() {
+				err := stateDir.WriteDNSRecords(records)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "dns-records.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(MatchJSON(`[{"domain": "*.cf.example.com", "type": "A", "value": "35.1.2.3"}]`))
+			})
+
+			It("removes a stale file when there are no records", func() {
+				err := stateDir.WriteDNSRecords(records)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = stateDir.WriteDNSRecords(nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(tmpDir, "dns-records.json"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
 		Describe("ExpungeInteropFiles", func() {
 			Context("when the interop files are present", func() {
 				BeforeEach(func() {
 					err := stateDir.WriteInteropFiles("banana", boshConfig)
 					Expect(err).NotTo(HaveOccurred())
+
+					err = stateDir.WriteBoshEnv(outrunner.BoshEnv{JumpboxURL: "da-url", JumpboxSSHKey: "da-key"})
+					Expect(err).NotTo(HaveOccurred())
+
+					err = stateDir.WriteCredhubEnv(outrunner.CredhubEnv{})
+					Expect(err).NotTo(HaveOccurred())
+
+					err = stateDir.WriteSSHConfig(outrunner.SSHConfig{JumpboxURL: "da-url", JumpboxSSHKey: "da-key", HostKey: "da-host-key"})
+					Expect(err).NotTo(HaveOccurred())
+
+					err = stateDir.WriteTerraformOutputs(outrunner.TerraformOutputs{"network_name": "some-env-network"})
+					Expect(err).NotTo(HaveOccurred())
+
+					err = stateDir.WriteDNSRecords([]outrunner.DNSRecord{{Domain: "ci.example.com", Type: "A", Value: "35.1.2.3"}})
+					Expect(err).NotTo(HaveOccurred())
 				})
 
 				It("deletes the interop files", func() {
@@ -231,6 +516,11 @@ with two lines`,
 
 					_, err = ioutil.ReadFile(filepath.Join(tmpDir, "name"))
 					Expect(err).To(HaveOccurred())
+
+					for _, file := range []string{"bosh-env.sh", "bosh-env.json", "credhub-env.sh", "credhub.json", "ssh_config", "known_hosts", "jumpbox-private.key", "terraform-outputs.json", "vars.yml", "dns-records.json"} {
+						_, err = ioutil.ReadFile(filepath.Join(tmpDir, file))
+						Expect(err).To(HaveOccurred())
+					}
 				})
 			})
 
@@ -0,0 +1,143 @@
+package outrunner_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// trimmed from a real bbl 8 gcp state
+const fullBblState = `{
+	"version": 14,
+	"bblVersion": "v8.4.92",
+	"iaas": "gcp",
+	"id": "some-id",
+	"envID": "some-env-id",
+	"aws": {},
+	"azure": {},
+	"cloudstack": {},
+	"gcp": {
+		"zone": "us-east1-b",
+		"region": "us-east1",
+		"zones": ["us-east1-b", "us-east1-c", "us-east1-d"]
+	},
+	"vsphere": {},
+	"openstack": {},
+	"jumpbox": {
+		"url": "35.1.2.3:22"
+	},
+	"bosh": {
+		"directorName": "bosh-some-env-id",
+		"directorUsername": "admin",
+		"directorPassword": "some-director-password",
+		"directorAddress": "https://10.0.0.6:25555",
+		"directorSSLCA": "some-ca",
+		"directorSSLCertificate": "some-cert",
+		"directorSSLPrivateKey": "some-key",
+		"userOpsFile": ""
+	},
+	"tfState": "",
+	"lb": {
+		"type": "cf",
+		"cert": "some-lb-cert",
+		"key": "some-lb-key",
+		"chain": "",
+		"domain": "cf.example.com"
+	},
+	"latestTFOutput": "Apply complete!",
+	"noDirector": false,
+	"migratedFromCloudFormation": false
+}`
+
+var _ = Describe("BblState", func() {
+	It("decodes everything bbl writes", func() {
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(fullBblState), &state)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(state.Version).To(Equal(outrunner.StateVersion))
+		Expect(state.BBLVersion).To(Equal("v8.4.92"))
+		Expect(state.ID).To(Equal("some-id"))
+		Expect(state.GCP.Zones).To(ConsistOf("us-east1-b", "us-east1-c", "us-east1-d"))
+		Expect(state.Director.Name).To(Equal("bosh-some-env-id"))
+		Expect(state.Director.SSLPrivateKey).To(Equal("some-key"))
+		Expect(state.LB).To(Equal(outrunner.LB{
+			Type:   "cf",
+			Cert:   "some-lb-cert",
+			Key:    "some-lb-key",
+			Domain: "cf.example.com",
+		}))
+		Expect(state.LatestTFOutput).To(Equal("Apply complete!"))
+		Expect(state.HasDirector()).To(BeTrue())
+		Expect(state.Extra).To(BeEmpty())
+	})
+
+	It("round trips", func() {
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(fullBblState), &state)
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := json.Marshal(state)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchJSON(fullBblState))
+	})
+
+	It("round trips the embedded bosh states of older bbls", func() {
+		older := `{
+			"version": 3,
+			"jumpbox": {"url": "35.1.2.3:22", "manifest": "some-manifest", "variables": "some-vars", "state": {"current_vm_cid": "vm-123"}},
+			"bosh": {"directorAddress": "https://10.0.0.6:25555", "state": {"current_vm_cid": "vm-456"}}
+		}`
+
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(older), &state)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Jumpbox.State).To(MatchJSON(`{"current_vm_cid": "vm-123"}`))
+
+		out, err := json.Marshal(state)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(out).To(MatchJSON(`{
+			"version": 3, "bblVersion": "", "iaas": "", "id": "", "envID": "",
+			"aws": {}, "azure": {}, "cloudstack": {}, "gcp": {}, "vsphere": {}, "openstack": {},
+			"jumpbox": {"url": "35.1.2.3:22", "manifest": "some-manifest", "variables": "some-vars", "state": {"current_vm_cid": "vm-123"}},
+			"bosh": {
+				"directorName": "", "directorUsername": "", "directorPassword": "",
+				"directorAddress": "https://10.0.0.6:25555",
+				"directorSSLCA": "", "directorSSLCertificate": "", "directorSSLPrivateKey": "",
+				"state": {"current_vm_cid": "vm-456"},
+				"userOpsFile": ""
+			},
+			"tfState": "", "lb": {"type": "", "cert": "", "key": "", "chain": ""}, "latestTFOutput": "",
+			"noDirector": false, "migratedFromCloudFormation": false
+		}`))
+	})
+
+	It("keeps fields from newer bbls", func() {
+		newer := `{"version": 15, "envID": "some-env-id", "someNewField": {"a": 1}}`
+
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(newer), &state)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Extra).To(HaveKey("someNewField"))
+
+		out, err := json.Marshal(state)
+		Expect(err).NotTo(HaveOccurred())
+
+		var fields map[string]interface{}
+		err = json.Unmarshal(out, &fields)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fields).To(HaveKeyWithValue("someNewField", map[string]interface{}{"a": 1.0}))
+		Expect(fields).To(HaveKeyWithValue("envID", "some-env-id"))
+	})
+
+	It("has no director when bbl was told not to make one", func() {
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(`{"noDirector": true, "bosh": {"directorAddress": "https://10.0.0.6:25555"}}`), &state)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(state.HasDirector()).To(BeFalse())
+	})
+})
@@ -0,0 +1,18 @@
+package outrunner
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// what `bbl version` says, e.g. "bbl 8.4.92 (linux/amd64)", or "unknown"
+func BBLVersion(ctx context.Context, path string) string {
+	cmd := exec.CommandContext(ctx, path, "version")
+	cmd.Env = childEnv(nil)
+	output, err := cmd.Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,49 @@
+package outrunner
+
+const (
+	BoshEnvScriptFile = "bosh-env.sh"
+	BoshEnvJSONFile   = "bosh-env.json"
+)
+
+// what bbl print-env would export for the bosh cli, without needing bbl
+type BoshEnv struct {
+	Environment   string
+	Client        string
+	ClientSecret  string
+	CACert        string
+	JumpboxURL    string
+	JumpboxSSHKey string
+}
+
+func NewBoshEnv(state BblState, jumpboxSSHKey string) BoshEnv {
+	return BoshEnv{
+		Environment:   state.Director.Address,
+		Client:        state.Director.ClientUsername,
+		ClientSecret:  state.Director.ClientSecret,
+		CACert:        state.Director.CaCert,
+		JumpboxURL:    state.Jumpbox.URL,
+		JumpboxSSHKey: jumpboxSSHKey,
+	}
+}
+
+func (e BoshEnv) envScript() envScript {
+	return envScript{
+		vars: []envVar{
+			{"BOSH_ENVIRONMENT", e.Environment},
+			{"BOSH_CLIENT", e.Client},
+			{"BOSH_CLIENT_SECRET", e.ClientSecret},
+			{"BOSH_CA_CERT", e.CACert},
+		},
+		proxyVar:      "BOSH_ALL_PROXY",
+		jumpboxURL:    e.JumpboxURL,
+		jumpboxSSHKey: e.JumpboxSSHKey,
+	}
+}
+
+func (e BoshEnv) Script() string {
+	return e.envScript().script()
+}
+
+func (e BoshEnv) JSON() ([]byte, error) {
+	return e.envScript().json()
+}
@@ -0,0 +1,109 @@
+package outrunner_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BoshEnv", func() {
+	var env outrunner.BoshEnv
+
+	BeforeEach(func() {
+		var state outrunner.BblState
+		state.Director.Address = "https://10.0.0.6:25555"
+		state.Director.ClientUsername = "admin"
+		state.Director.ClientSecret = "it's-a-secret"
+		state.Director.CaCert = "-----BEGIN CERTIFICATE-----\nsome-ca\n-----END CERTIFICATE-----"
+		state.Jumpbox.URL = "35.1.2.3:22"
+
+		env = outrunner.NewBoshEnv(state, "some-ssh-key")
+	})
+
+	Describe("JSON", func() {
+		It("has the same variables as the script, with the key relative to the state dir", func() {
+			bytes, err := env.JSON()
+			Expect(err).NotTo(HaveOccurred())
+
+			var vars map[string]string
+			Expect(json.Unmarshal(bytes, &vars)).To(Succeed())
+			Expect(vars).To(Equal(map[string]string{
+				"BOSH_ENVIRONMENT":    "https://10.0.0.6:25555",
+				"BOSH_CLIENT":         "admin",
+				"BOSH_CLIENT_SECRET":  "it's-a-secret",
+				"BOSH_CA_CERT":        "-----BEGIN CERTIFICATE-----\nsome-ca\n-----END CERTIFICATE-----",
+				"JUMPBOX_PRIVATE_KEY": "jumpbox-private.key",
+				"BOSH_ALL_PROXY":      "ssh+socks5://jumpbox@35.1.2.3:22?private-key=jumpbox-private.key",
+			}))
+		})
+
+		It("leaves out the proxy without a jumpbox key", func() {
+			env.JumpboxSSHKey = ""
+
+			bytes, err := env.JSON()
+			Expect(err).NotTo(HaveOccurred())
+
+			var vars map[string]string
+			Expect(json.Unmarshal(bytes, &vars)).To(Succeed())
+			Expect(vars).NotTo(HaveKey("BOSH_ALL_PROXY"))
+			Expect(vars).NotTo(HaveKey("JUMPBOX_PRIVATE_KEY"))
+			Expect(vars).To(HaveKeyWithValue("BOSH_ENVIRONMENT", "https://10.0.0.6:25555"))
+		})
+	})
+
+	Describe("Script", func() {
+		var stateDir, workDir string
+
+		BeforeEach(func() {
+			if _, err := exec.LookPath("bash"); err != nil {
+				Skip("bash is not installed")
+			}
+
+			var err error
+			stateDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+			workDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(stateDir, "bosh-env.sh"), []byte(env.Script()), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(stateDir)
+			os.RemoveAll(workDir)
+		})
+
+		source := func(script, variable string) string {
+			cmd := exec.Command("bash", "-c", `source "$1" && printf %s "${!2}"`, "bash", script, variable)
+			cmd.Dir = workDir
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			return string(out)
+		}
+
+		It("exports the director credentials, quoted", func() {
+			script := filepath.Join(stateDir, "bosh-env.sh")
+			Expect(source(script, "BOSH_ENVIRONMENT")).To(Equal("https://10.0.0.6:25555"))
+			Expect(source(script, "BOSH_CLIENT")).To(Equal("admin"))
+			Expect(source(script, "BOSH_CLIENT_SECRET")).To(Equal("it's-a-secret"))
+			Expect(source(script, "BOSH_CA_CERT")).To(Equal("-----BEGIN CERTIFICATE-----\nsome-ca\n-----END CERTIFICATE-----"))
+		})
+
+		It("proxies through the jumpbox with the key next to the script, wherever it is sourced from", func() {
+			script, err := filepath.Rel(workDir, filepath.Join(stateDir, "bosh-env.sh"))
+			Expect(err).NotTo(HaveOccurred())
+
+			key := filepath.Join(stateDir, "jumpbox-private.key")
+
+			Expect(source(script, "JUMPBOX_PRIVATE_KEY")).To(Equal(key))
+			Expect(source(script, "BOSH_ALL_PROXY")).To(Equal("ssh+socks5://jumpbox@35.1.2.3:22?private-key=" + key))
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package outrunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+const (
+	DefaultCheckpointInterval = 5 * time.Second
+	DefaultCheckpointDebounce = 30 * time.Second
+)
+
+// the files bbl and terraform rewrite as they create infrastructure
+var CheckpointFiles = []string{
+	"bbl-state.json",
+	filepath.Join("vars", "terraform.tfstate"),
+}
+
+// Checkpointer polls a state dir while bbl runs and calls Upload once
+// the watched files have changed and then stayed put for Debounce,
+// so a worker dying mid-apply doesn't take the only copy of the state with it
+type Checkpointer struct {
+	Dir      string
+	Files    []string
+	Interval time.Duration
+	Debounce time.Duration
+	Upload   func(ctx context.Context) error
+}
+
+// checkpointing is on unless the source disables it
+func NewCheckpointer(source concourse.Source, dir string, upload func(ctx context.Context) error) (Checkpointer, bool, error) {
+	c := Checkpointer{Dir: dir, Files: CheckpointFiles, Upload: upload}
+	if source.Checkpoint == nil {
+		return c, true, nil
+	}
+	if source.Checkpoint.Disabled {
+		return Checkpointer{}, false, nil
+	}
+
+	var err error
+	if source.Checkpoint.Interval != "" {
+		c.Interval, err = time.ParseDuration(source.Checkpoint.Interval)
+		if err != nil {
+			return Checkpointer{}, false, fmt.Errorf("invalid checkpoint.interval: %s", err)
+		}
+	}
+	if source.Checkpoint.Debounce != "" {
+		c.Debounce, err = time.ParseDuration(source.Checkpoint.Debounce)
+		if err != nil {
+			return Checkpointer{}, false, fmt.Errorf("invalid checkpoint.debounce: %s", err)
+		}
+	}
+	return c, true, nil
+}
+
+// snapshots the watched files, then watches them in the background
+// until ctx is done. the returned channel is closed once it has stopped.
+func (c Checkpointer) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	uploaded := c.fingerprint()
+	go func() {
+		defer close(done)
+		c.watch(ctx, uploaded)
+	}()
+	return done
+}
+
+func (c Checkpointer) watch(ctx context.Context, uploaded string) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	debounce := c.Debounce
+	if debounce <= 0 {
+		debounce = DefaultCheckpointDebounce
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	seen := uploaded
+	var changedAt time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			current := c.fingerprint()
+			if current != seen {
+				seen = current
+				changedAt = now
+				continue
+			}
+			if current == uploaded || now.Sub(changedAt) < debounce {
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "bbl state changed, uploading a checkpoint...\n")
+			err := c.Upload(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to upload checkpoint: %s\n", err)
+				continue // try again next tick
+			}
+			uploaded = current
+		}
+	}
+}
+
+// cheap enough to poll: sizes and modification times, not contents
+func (c Checkpointer) fingerprint() string {
+	var fp string
+	for _, file := range c.Files {
+		info, err := os.Stat(filepath.Join(c.Dir, file))
+		if err != nil {
+			fp += file + ":missing;"
+			continue
+		}
+		fp += fmt.Sprintf("%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return fp
+}
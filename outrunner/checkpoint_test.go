@@ -0,0 +1,105 @@
+package outrunner_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checkpointer", func() {
+	var (
+		tmpDir       string
+		uploads      int32
+		checkpointer outrunner.Checkpointer
+		cancel       context.CancelFunc
+		done         <-chan struct{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(tmpDir, "bbl-state.json"), []byte("{}"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		atomic.StoreInt32(&uploads, 0)
+		checkpointer = outrunner.Checkpointer{
+			Dir:      tmpDir,
+			Files:    outrunner.CheckpointFiles,
+			Interval: 10 * time.Millisecond,
+			Debounce: 50 * time.Millisecond,
+			Upload: func(ctx context.Context) error {
+				atomic.AddInt32(&uploads, 1)
+				return nil
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = checkpointer.Start(ctx)
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	It("doesn't upload while nothing changes", func() {
+		Consistently(func() int32 { return atomic.LoadInt32(&uploads) }, 200*time.Millisecond).Should(BeZero())
+	})
+
+	It("uploads once a watched file changes and settles", func() {
+		err := os.MkdirAll(filepath.Join(tmpDir, "vars"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(tmpDir, "vars", "terraform.tfstate"), []byte("{}"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() int32 { return atomic.LoadInt32(&uploads) }).Should(Equal(int32(1)))
+		Consistently(func() int32 { return atomic.LoadInt32(&uploads) }, 200*time.Millisecond).Should(Equal(int32(1)))
+	})
+
+	It("ignores files it isn't watching", func() {
+		err := ioutil.WriteFile(filepath.Join(tmpDir, "name"), []byte("some-env-name"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		Consistently(func() int32 { return atomic.LoadInt32(&uploads) }, 200*time.Millisecond).Should(BeZero())
+	})
+})
+
+var _ = Describe("NewCheckpointer", func() {
+	It("checkpoints by default", func() {
+		_, enabled, err := outrunner.NewCheckpointer(concourse.Source{}, "some-dir", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+	})
+
+	It("can be disabled", func() {
+		_, enabled, err := outrunner.NewCheckpointer(concourse.Source{Checkpoint: &concourse.Checkpoint{Disabled: true}}, "some-dir", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("reads the interval and debounce from source", func() {
+		checkpointer, _, err := outrunner.NewCheckpointer(concourse.Source{Checkpoint: &concourse.Checkpoint{Interval: "1s", Debounce: "1m"}}, "some-dir", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpointer.Interval).To(Equal(time.Second))
+		Expect(checkpointer.Debounce).To(Equal(time.Minute))
+	})
+
+	It("rejects invalid durations", func() {
+		_, _, err := outrunner.NewCheckpointer(concourse.Source{Checkpoint: &concourse.Checkpoint{Interval: "soon"}}, "some-dir", nil)
+		Expect(err).To(MatchError(ContainSubstring("invalid checkpoint.interval")))
+	})
+})
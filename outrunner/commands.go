@@ -0,0 +1,109 @@
+package outrunner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+// flags every bbl command understands
+var globalArgs = []string{"debug"}
+
+// what bbl up and bbl plan take, besides the name we give them
+var upArgs = []string{"no-director", "lb-type", "lb-cert", "lb-key", "lb-chain", "lb-domain"}
+
+type Command struct {
+	Name string
+	// the params.args it accepts, anything else is a typo
+	// we'd rather catch before bbl starts touching the environment
+	Args []string
+	// deletes iaas resources
+	Destructive bool
+	// only makes sense against an environment that's already been bbl'd up
+	NeedsState bool
+	// changes the state, so it has to be uploaded afterwards
+	UploadState bool
+	// bbl plan can preview what it would do
+	Plans bool
+}
+
+// readOnly commands print something from an existing state
+func readOnly(name string) Command {
+	return Command{Name: name, NeedsState: true}
+}
+
+var Commands = map[string]Command{
+	"up":                {Name: "up", Args: upArgs, UploadState: true, Plans: true},
+	"plan":              {Name: "plan", Args: upArgs, UploadState: true, Plans: true},
+	"down":              {Name: "down", Args: []string{"skip-if-missing"}, Destructive: true, NeedsState: true, UploadState: true},
+	"destroy":           {Name: "destroy", Args: []string{"skip-if-missing"}, Destructive: true, NeedsState: true, UploadState: true},
+	"rotate":            {Name: "rotate", NeedsState: true, UploadState: true},
+	"cleanup-leftovers": {Name: "cleanup-leftovers", Args: []string{"filter", "dry-run"}, Destructive: true},
+	"lbs":               {Name: "lbs", Args: []string{"json"}, NeedsState: true},
+	"outputs":           readOnly("outputs"),
+	"env-id":            readOnly("env-id"),
+	"latest-error":      readOnly("latest-error"),
+	"jumpbox-address":   readOnly("jumpbox-address"),
+	"director-address":  readOnly("director-address"),
+}
+
+// bbl commands that print credentials. bbl's output goes to the build log,
+// which anyone who can see the pipeline can read, so they're never run
+var CredentialCommands = []string{
+	"print-env",
+	"director-username",
+	"director-password",
+	"director-ca-cert",
+	"ssh-key",
+	"director-ssh-key",
+}
+
+func LookupCommand(name string) (Command, error) {
+	if name == "" {
+		return Command{}, fmt.Errorf("missing required param: command")
+	}
+	for _, n := range CredentialCommands {
+		if n == name {
+			return Command{}, fmt.Errorf("bbl %s prints credentials into the build log, get the bbl state and use bosh-env.sh, credhub-env.sh or jumpbox-private.key instead", name)
+		}
+	}
+
+	command, ok := Commands[name]
+	if !ok {
+		names := make([]string, 0, len(Commands))
+		for n := range Commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Command{}, fmt.Errorf("unsupported command %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return command, nil
+}
+
+func (c Command) ValidateArgs(args concourse.Args) error {
+	allowed := map[string]bool{}
+	for _, name := range globalArgs {
+		allowed[name] = true
+	}
+	for _, name := range c.Args {
+		allowed[name] = true
+	}
+
+	var unknown []string
+	for _, name := range args.Names() {
+		if !allowed[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown args for bbl %s: %s", c.Name, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// down and destroy can be told there might be nothing to do
+func (c Command) StateRequired(args concourse.Args) bool {
+	return c.NeedsState && !args["skip-if-missing"].Switch
+}
@@ -0,0 +1,84 @@
+package outrunner_test
+
+import (
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Commands", func() {
+	Describe("LookupCommand", func() {
+		It("finds supported commands", func() {
+			command, err := outrunner.LookupCommand("down")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(command.Name).To(Equal("down"))
+			Expect(command.Destructive).To(BeTrue())
+			Expect(command.NeedsState).To(BeTrue())
+			Expect(command.UploadState).To(BeTrue())
+		})
+
+		It("rejects typos", func() {
+			_, err := outrunner.LookupCommand("dwon")
+			Expect(err).To(MatchError(ContainSubstring(`unsupported command "dwon", expected one of: `)))
+			Expect(err).To(MatchError(ContainSubstring("cleanup-leftovers, destroy")))
+		})
+
+		It("never runs a command that prints credentials into the build log", func() {
+			Expect(outrunner.CredentialCommands).To(ContainElements("print-env", "director-password", "ssh-key", "director-ssh-key"))
+			for _, name := range outrunner.CredentialCommands {
+				Expect(outrunner.Commands).NotTo(HaveKey(name))
+
+				_, err := outrunner.LookupCommand(name)
+				Expect(err).To(MatchError(ContainSubstring("bbl %s prints credentials into the build log", name)))
+			}
+		})
+
+		It("requires a command", func() {
+			_, err := outrunner.LookupCommand("")
+			Expect(err).To(MatchError("missing required param: command"))
+		})
+	})
+
+	Describe("ValidateArgs", func() {
+		It("accepts the command's args and global args", func() {
+			command := outrunner.Commands["cleanup-leftovers"]
+			Expect(command.ValidateArgs(concourse.Args{
+				"filter":  concourse.StringArg("some-env"),
+				"dry-run": concourse.BoolArg(true),
+				"debug":   concourse.BoolArg(true),
+			})).To(Succeed())
+		})
+
+		It("accepts every flag bbl up and bbl plan take", func() {
+			args := concourse.Args{
+				"no-director": concourse.BoolArg(true),
+				"lb-type":     concourse.StringArg("cf"),
+				"lb-cert":     concourse.StringArg("/path/to/lb/cert"),
+				"lb-key":      concourse.StringArg("/path/to/lb/key"),
+				"lb-chain":    concourse.StringArg("/path/to/lb/chain"),
+				"lb-domain":   concourse.StringArg("cf.example.com"),
+			}
+			Expect(outrunner.Commands["up"].ValidateArgs(args)).To(Succeed())
+			Expect(outrunner.Commands["plan"].ValidateArgs(args)).To(Succeed())
+		})
+
+		It("rejects args the command doesn't take", func() {
+			command := outrunner.Commands["rotate"]
+			err := command.ValidateArgs(concourse.Args{
+				"lb-cert": concourse.StringArg("some-cert"),
+				"filter":  concourse.StringArg("some-env"),
+			})
+			Expect(err).To(MatchError("unknown args for bbl rotate: filter, lb-cert"))
+		})
+	})
+
+	Describe("StateRequired", func() {
+		It("is waived by skip-if-missing", func() {
+			command := outrunner.Commands["down"]
+			Expect(command.StateRequired(concourse.Args{})).To(BeTrue())
+			Expect(command.StateRequired(concourse.Args{"skip-if-missing": concourse.BoolArg(true)})).To(BeFalse())
+			Expect(outrunner.Commands["up"].StateRequired(concourse.Args{})).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package outrunner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+var semverPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+type semver [3]int
+
+// finds the version in either bbl-state.json's "v8.4.92" or `bbl version`'s "bbl 8.4.92 (linux/amd64)"
+func parseSemver(s string) (semver, bool) {
+	match := semverPattern.FindStringSubmatch(s)
+	if match == nil {
+		return semver{}, false
+	}
+	var v semver
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	return v, true
+}
+
+func (v semver) compare(other semver) int {
+	for i := range v {
+		if v[i] != other[i] {
+			if v[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// what bbl is known to rewrite when it loads a state from an older schema
+func knownMigrations(state BblState) []string {
+	migrations := []string{}
+	if state.TFState != "" {
+		migrations = append(migrations, "the terraform state embedded in bbl-state.json will move to vars/terraform.tfstate")
+	}
+	if len(state.Jumpbox.State) > 0 || state.Jumpbox.Manifest != "" || state.Jumpbox.Variables != "" {
+		migrations = append(migrations, "the jumpbox's create-env state, manifest and variables embedded in bbl-state.json will move to vars/")
+	}
+	if len(state.Director.State) > 0 || state.Director.Manifest != "" || state.Director.Variables != "" {
+		migrations = append(migrations, "the director's create-env state, manifest and variables embedded in bbl-state.json will move to vars/")
+	}
+	return migrations
+}
+
+// refuses to let the bundled bbl downgrade a state written by a newer one, and to
+// upgrade an older state's schema unless allow_state_upgrade says so. anything
+// else worth knowing comes back as warnings.
+func CheckCompatibility(state BblState, bblVersion string, command Command, params concourse.OutParams) ([]string, error) {
+	warnings := []string{}
+	if state.Version == 0 {
+		return warnings, nil // no state yet
+	}
+
+	if state.Version > StateVersion {
+		return warnings, fmt.Errorf("bbl-state.json has state version %d, but the bundled bbl only understands up to %d: refusing to downgrade it", state.Version, StateVersion)
+	}
+
+	bundled, bundledKnown := parseSemver(bblVersion)
+	last, lastKnown := parseSemver(state.BBLVersion)
+	if !bundledKnown {
+		warnings = append(warnings, fmt.Sprintf("can't tell which version of bbl is bundled from %q, so can't check it against the bbl that last wrote the state", bblVersion))
+	} else if lastKnown {
+		switch last.compare(bundled) {
+		case 1:
+			return warnings, fmt.Errorf("bbl-state.json was last written by bbl %s, which is newer than the bundled bbl %s: refusing to downgrade it", last, bundled)
+		case -1:
+			if command.UploadState && state.Version == StateVersion {
+				warnings = append(warnings, fmt.Sprintf("bbl-state.json was last written by bbl %s, the bundled bbl %s will rewrite it", last, bundled))
+			}
+		}
+	}
+
+	if state.Version == StateVersion {
+		return warnings, nil
+	}
+
+	upgrade := fmt.Sprintf("bbl %s will upgrade bbl-state.json from state version %d to %d, which older bbls can't read", command.Name, state.Version, StateVersion)
+	if !command.UploadState {
+		// the upgraded state isn't uploaded
+		return warnings, nil
+	}
+	migrations := knownMigrations(state)
+	if !params.AllowStateUpgrade {
+		return append(warnings, migrations...), fmt.Errorf("%s: set allow_state_upgrade: true to go ahead", upgrade)
+	}
+	warnings = append(warnings, upgrade)
+	return append(warnings, migrations...), nil
+}
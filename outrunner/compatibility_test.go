@@ -0,0 +1,107 @@
+package outrunner_test
+
+import (
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckCompatibility", func() {
+	var (
+		state   outrunner.BblState
+		up      outrunner.Command
+		envID   outrunner.Command
+		params  concourse.OutParams
+		bundled = "bbl 8.4.92 (linux/amd64)"
+	)
+
+	BeforeEach(func() {
+		state = outrunner.BblState{Version: outrunner.StateVersion, BBLVersion: "v8.4.92"}
+		up, _ = outrunner.LookupCommand("up")
+		envID, _ = outrunner.LookupCommand("env-id")
+		params = concourse.OutParams{}
+	})
+
+	It("has nothing to say about a state the bundled bbl wrote", func() {
+		warnings, err := outrunner.CheckCompatibility(state, bundled, up, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("has nothing to say about a brand new environment", func() {
+		warnings, err := outrunner.CheckCompatibility(outrunner.BblState{}, bundled, up, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	Context("when a newer bbl wrote the state", func() {
+		It("refuses to downgrade its schema", func() {
+			state.Version = outrunner.StateVersion + 1
+
+			_, err := outrunner.CheckCompatibility(state, bundled, envID, params)
+			Expect(err).To(MatchError(ContainSubstring("refusing to downgrade it")))
+		})
+
+		It("refuses to downgrade its bbl version", func() {
+			state.BBLVersion = "v8.10.0"
+
+			_, err := outrunner.CheckCompatibility(state, bundled, up, params)
+			Expect(err).To(MatchError("bbl-state.json was last written by bbl 8.10.0, which is newer than the bundled bbl 8.4.92: refusing to downgrade it"))
+		})
+	})
+
+	Context("when an older bbl wrote the state", func() {
+		BeforeEach(func() {
+			state.BBLVersion = "v8.4.0"
+		})
+
+		It("warns that it'll be rewritten", func() {
+			warnings, err := outrunner.CheckCompatibility(state, bundled, up, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf("bbl-state.json was last written by bbl 8.4.0, the bundled bbl 8.4.92 will rewrite it"))
+		})
+
+		It("doesn't warn for commands that don't upload the state", func() {
+			warnings, err := outrunner.CheckCompatibility(state, bundled, envID, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+	})
+
+	Context("when the state has an older schema", func() {
+		BeforeEach(func() {
+			state = outrunner.BblState{
+				Version:    outrunner.StateVersion - 1,
+				BBLVersion: "v6.0.0",
+				TFState:    "some-tf-state",
+			}
+		})
+
+		It("refuses to upgrade it without allow_state_upgrade, listing the migrations", func() {
+			warnings, err := outrunner.CheckCompatibility(state, bundled, up, params)
+			Expect(err).To(MatchError(ContainSubstring("bbl up will upgrade bbl-state.json from state version 13 to 14, which older bbls can't read: set allow_state_upgrade: true to go ahead")))
+			Expect(warnings).To(ContainElement(ContainSubstring("vars/terraform.tfstate")))
+		})
+
+		It("upgrades it with allow_state_upgrade", func() {
+			params.AllowStateUpgrade = true
+
+			warnings, err := outrunner.CheckCompatibility(state, bundled, up, params)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("from state version 13 to 14")))
+			Expect(warnings).To(ContainElement(ContainSubstring("vars/terraform.tfstate")))
+		})
+
+		It("doesn't need allow_state_upgrade for commands that don't upload the state", func() {
+			_, err := outrunner.CheckCompatibility(state, bundled, envID, params)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("warns when it can't tell which bbl is bundled", func() {
+		warnings, err := outrunner.CheckCompatibility(state, "unknown", up, params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring(`can't tell which version of bbl is bundled from "unknown"`)))
+	})
+})
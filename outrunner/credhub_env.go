@@ -0,0 +1,83 @@
+package outrunner
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	CredhubEnvScriptFile = "credhub-env.sh"
+	CredhubJSONFile      = "credhub.json"
+
+	credhubPort   = "8844"
+	credhubClient = "credhub-admin"
+)
+
+// the parts of vars/director-vars-store.yml a credhub client needs
+type CredhubCredentials struct {
+	ClientSecret string `yaml:"credhub_admin_client_secret"`
+	TLS          struct {
+		CA string `yaml:"ca"`
+	} `yaml:"credhub_tls"`
+	UAASSL struct {
+		CA string `yaml:"ca"`
+	} `yaml:"uaa_ssl"`
+}
+
+// what bbl print-env would export for the credhub cli, without needing bbl
+type CredhubEnv struct {
+	Server        string
+	CACert        string
+	Client        string
+	Secret        string
+	JumpboxURL    string
+	JumpboxSSHKey string
+}
+
+func NewCredhubEnv(state BblState, creds CredhubCredentials, jumpboxSSHKey string) CredhubEnv {
+	env := CredhubEnv{
+		Client:        credhubClient,
+		Secret:        creds.ClientSecret,
+		JumpboxURL:    state.Jumpbox.URL,
+		JumpboxSSHKey: jumpboxSSHKey,
+	}
+
+	// credhub runs on the director, next to the bosh api
+	if address, err := url.Parse(state.Director.Address); err == nil && address.Hostname() != "" {
+		env.Server = "https://" + net.JoinHostPort(address.Hostname(), credhubPort)
+	}
+
+	// the cli has to trust credhub's cert and uaa's, which it gets its token from
+	cas := []string{}
+	for _, ca := range []string{creds.TLS.CA, creds.UAASSL.CA} {
+		if ca = strings.TrimSpace(ca); ca != "" {
+			cas = append(cas, ca)
+		}
+	}
+	env.CACert = strings.Join(cas, "\n")
+
+	return env
+}
+
+func (e CredhubEnv) envScript() envScript {
+	return envScript{
+		vars: []envVar{
+			{"CREDHUB_SERVER", e.Server},
+			{"CREDHUB_CA_CERT", e.CACert},
+			{"CREDHUB_CLIENT", e.Client},
+			{"CREDHUB_SECRET", e.Secret},
+		},
+		proxyVar:      "CREDHUB_PROXY",
+		jumpboxURL:    e.JumpboxURL,
+		jumpboxSSHKey: e.JumpboxSSHKey,
+	}
+}
+
+func (e CredhubEnv) Script() string {
+	return e.envScript().script()
+}
+
+func (e CredhubEnv) JSON() ([]byte, error) {
+	return e.envScript().json()
+}
@@ -0,0 +1,66 @@
+package outrunner_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CredhubEnv", func() {
+	var (
+		state outrunner.BblState
+		creds outrunner.CredhubCredentials
+	)
+
+	BeforeEach(func() {
+		state = outrunner.BblState{}
+		state.Director.Address = "https://10.0.0.6:25555"
+		state.Jumpbox.URL = "35.1.2.3:22"
+
+		creds = outrunner.CredhubCredentials{ClientSecret: "some-secret"}
+		creds.TLS.CA = "credhub-ca\n"
+		creds.UAASSL.CA = "uaa-ca\n"
+	})
+
+	It("points at credhub on the director, trusting both credhub and uaa", func() {
+		env := outrunner.NewCredhubEnv(state, creds, "some-ssh-key")
+		Expect(env).To(Equal(outrunner.CredhubEnv{
+			Server:        "https://10.0.0.6:8844",
+			CACert:        "credhub-ca\nuaa-ca",
+			Client:        "credhub-admin",
+			Secret:        "some-secret",
+			JumpboxURL:    "35.1.2.3:22",
+			JumpboxSSHKey: "some-ssh-key",
+		}))
+	})
+
+	It("has no server without a director address", func() {
+		state.Director.Address = ""
+
+		env := outrunner.NewCredhubEnv(state, creds, "some-ssh-key")
+		Expect(env.Server).To(BeEmpty())
+	})
+
+	It("proxies through the jumpbox with CREDHUB_PROXY", func() {
+		env := outrunner.NewCredhubEnv(state, creds, "some-ssh-key")
+
+		Expect(env.Script()).To(ContainSubstring(`export CREDHUB_SERVER='https://10.0.0.6:8844'`))
+		Expect(env.Script()).To(ContainSubstring(`export CREDHUB_PROXY='ssh+socks5://jumpbox@35.1.2.3:22?private-key='"${JUMPBOX_PRIVATE_KEY}"`))
+
+		bytes, err := env.JSON()
+		Expect(err).NotTo(HaveOccurred())
+
+		var vars map[string]string
+		Expect(json.Unmarshal(bytes, &vars)).To(Succeed())
+		Expect(vars).To(Equal(map[string]string{
+			"CREDHUB_SERVER":      "https://10.0.0.6:8844",
+			"CREDHUB_CA_CERT":     "credhub-ca\nuaa-ca",
+			"CREDHUB_CLIENT":      "credhub-admin",
+			"CREDHUB_SECRET":      "some-secret",
+			"JUMPBOX_PRIVATE_KEY": "jumpbox-private.key",
+			"CREDHUB_PROXY":       "ssh+socks5://jumpbox@35.1.2.3:22?private-key=jumpbox-private.key",
+		}))
+	})
+})
@@ -0,0 +1,104 @@
+package outrunner
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// relative path -> sha256 of the contents of every file in a state dir,
+// other than the InteropFiles, which only ever reflect the rest of it
+type Snapshot map[string]string
+
+func TakeSnapshot(dir string) (Snapshot, error) {
+	interop := map[string]bool{}
+	for _, file := range InteropFiles {
+		interop[file] = true
+	}
+
+	snapshot := Snapshot{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if interop[rel] {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		snapshot[filepath.ToSlash(rel)] = fmt.Sprintf("%x", h.Sum(nil))
+		return nil
+	})
+	return snapshot, err
+}
+
+type StateDiff struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+func Diff(before, after Snapshot) StateDiff {
+	diff := StateDiff{}
+	for path, sum := range after {
+		previous, ok := before[path]
+		if !ok {
+			diff.Added = append(diff.Added, path)
+		} else if previous != sum {
+			diff.Modified = append(diff.Modified, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			diff.Deleted = append(diff.Deleted, path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Modified)
+	sort.Strings(diff.Deleted)
+	return diff
+}
+
+func (d StateDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Deleted) == 0
+}
+
+// one line per file, prefixed like `git status --short`
+func (d StateDiff) String() string {
+	if d.Empty() {
+		return "no changes\n"
+	}
+
+	var lines []string
+	for _, path := range d.Added {
+		lines = append(lines, fmt.Sprintf("A %s", path))
+	}
+	for _, path := range d.Modified {
+		lines = append(lines, fmt.Sprintf("M %s", path))
+	}
+	for _, path := range d.Deleted {
+		lines = append(lines, fmt.Sprintf("D %s", path))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,81 @@
+package outrunner_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	var dir string
+
+	write := func(path, contents string) {
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		write("bbl-state.json", `{"version": 14}`)
+		write("terraform/bbl-template.tf", "some-template")
+		write("vars/bbl.tfvars", "some-vars")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("lists the files that were added, modified and deleted", func() {
+		before, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		write("terraform/my-plan-patch-override.tf", "some-override")
+		write("terraform/bbl-template.tf", "some-new-template")
+		Expect(os.Remove(filepath.Join(dir, "vars", "bbl.tfvars"))).To(Succeed())
+
+		after, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		diff := outrunner.Diff(before, after)
+		Expect(diff).To(Equal(outrunner.StateDiff{
+			Added:    []string{"terraform/my-plan-patch-override.tf"},
+			Modified: []string{"terraform/bbl-template.tf"},
+			Deleted:  []string{"vars/bbl.tfvars"},
+		}))
+		Expect(diff.String()).To(Equal("A terraform/my-plan-patch-override.tf\nM terraform/bbl-template.tf\nD vars/bbl.tfvars\n"))
+	})
+
+	It("leaves out the files generated from the state", func() {
+		before, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		write("bosh-env.sh", "export BOSH_ENVIRONMENT=https://10.0.0.6:25555")
+		write("vars.yml", "network_name: some-env-network")
+		write("vars/director-vars-store.yml", "some-creds")
+
+		after, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(outrunner.Diff(before, after)).To(Equal(outrunner.StateDiff{
+			Added: []string{"vars/director-vars-store.yml"},
+		}))
+	})
+
+	It("says when nothing changed", func() {
+		before, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+		after, err := outrunner.TakeSnapshot(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(outrunner.Diff(before, after).Empty()).To(BeTrue())
+		Expect(outrunner.Diff(before, after).String()).To(Equal("no changes\n"))
+	})
+})
@@ -0,0 +1,91 @@
+package outrunner
+
+import (
+	"net"
+	"strings"
+)
+
+const DNSRecordsFile = "dns-records.json"
+
+type DNSRecord struct {
+	Domain string `json:"domain"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+// the terraform outputs bbl's templates give the name servers of the zone
+// it creates for the lb domain on gcp and aws
+var nameServerOutputs = []string{"system_domain_dns_servers", "env_dns_zone_name_servers"}
+
+type lbHostname struct {
+	subdomain string // "" for the lb domain itself
+	outputs   []string
+}
+
+// where each lb type's hostnames point, by the gcp and aws outputs for them
+var lbHostnames = map[string][]lbHostname{
+	"cf": {
+		{"*", []string{"router_lb_ip", "cf_router_lb_url"}},
+		{"ssh", []string{"ssh_proxy_lb_ip", "cf_ssh_lb_url"}},
+		{"tcp", []string{"tcp_router_lb_ip", "cf_tcp_lb_url"}},
+		{"doppler", []string{"ws_lb_ip"}},
+		{"loggregator", []string{"ws_lb_ip"}},
+	},
+	"concourse": {
+		{"", []string{"concourse_lb_ip", "concourse_lb_url"}},
+	},
+}
+
+// the records a dns provider needs for the lb domain to reach the lbs: a delegation
+// to the zone bbl created when there is one, otherwise a record for each lb hostname
+func DNSRecords(lb LB, outputs TerraformOutputs) []DNSRecord {
+	records := []DNSRecord{}
+	if lb.Type == "" || lb.Domain == "" {
+		return records
+	}
+	domain := strings.TrimSuffix(lb.Domain, ".")
+
+	for _, output := range nameServerOutputs {
+		for _, server := range outputStrings(outputs[output]) {
+			records = append(records, DNSRecord{Domain: domain, Type: "NS", Value: server})
+		}
+	}
+	if len(records) > 0 {
+		return records
+	}
+
+	for _, hostname := range lbHostnames[lb.Type] {
+		name := domain
+		if hostname.subdomain != "" {
+			name = hostname.subdomain + "." + domain
+		}
+		for _, output := range hostname.outputs {
+			for _, target := range outputStrings(outputs[output]) {
+				recordType := "CNAME"
+				if net.ParseIP(target) != nil {
+					recordType = "A"
+				}
+				records = append(records, DNSRecord{Domain: name, Type: recordType, Value: target})
+			}
+		}
+	}
+	return records
+}
+
+func outputStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package outrunner_test
+
+import (
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSRecords", func() {
+	var lb outrunner.LB
+
+	BeforeEach(func() {
+		lb = outrunner.LB{Type: "cf", Domain: "cf.example.com"}
+	})
+
+	It("delegates the lb domain to the zone bbl created", func() {
+		records := outrunner.DNSRecords(lb, outrunner.TerraformOutputs{
+			"router_lb_ip":              "35.1.2.3",
+			"system_domain_dns_servers": []interface{}{"ns-cloud-a1.googledomains.com.", "ns-cloud-a2.googledomains.com."},
+		})
+
+		Expect(records).To(Equal([]outrunner.DNSRecord{
+			{Domain: "cf.example.com", Type: "NS", Value: "ns-cloud-a1.googledomains.com."},
+			{Domain: "cf.example.com", Type: "NS", Value: "ns-cloud-a2.googledomains.com."},
+		}))
+	})
+
+	It("points each cf hostname at its lb without a zone", func() {
+		records := outrunner.DNSRecords(lb, outrunner.TerraformOutputs{
+			"router_lb_ip":     "35.1.2.3",
+			"ssh_proxy_lb_ip":  "35.1.2.4",
+			"tcp_router_lb_ip": "35.1.2.5",
+			"ws_lb_ip":         "35.1.2.6",
+		})
+
+		Expect(records).To(Equal([]outrunner.DNSRecord{
+			{Domain: "*.cf.example.com", Type: "A", Value: "35.1.2.3"},
+			{Domain: "ssh.cf.example.com", Type: "A", Value: "35.1.2.4"},
+			{Domain: "tcp.cf.example.com", Type: "A", Value: "35.1.2.5"},
+			{Domain: "doppler.cf.example.com", Type: "A", Value: "35.1.2.6"},
+			{Domain: "loggregator.cf.example.com", Type: "A", Value: "35.1.2.6"},
+		}))
+	})
+
+	It("uses CNAMEs for lbs that are addressed by name", func() {
+		records := outrunner.DNSRecords(lb, outrunner.TerraformOutputs{
+			"cf_router_lb_url": "some-router-lb.elb.amazonaws.com",
+		})
+
+		Expect(records).To(Equal([]outrunner.DNSRecord{
+			{Domain: "*.cf.example.com", Type: "CNAME", Value: "some-router-lb.elb.amazonaws.com"},
+		}))
+	})
+
+	It("points the domain itself at a concourse lb", func() {
+		lb = outrunner.LB{Type: "concourse", Domain: "ci.example.com."}
+
+		records := outrunner.DNSRecords(lb, outrunner.TerraformOutputs{"concourse_lb_ip": "35.1.2.3"})
+		Expect(records).To(Equal([]outrunner.DNSRecord{
+			{Domain: "ci.example.com", Type: "A", Value: "35.1.2.3"},
+		}))
+	})
+
+	It("has no records without an lb domain", func() {
+		lb.Domain = ""
+
+		records := outrunner.DNSRecords(lb, outrunner.TerraformOutputs{"router_lb_ip": "35.1.2.3"})
+		Expect(records).To(BeEmpty())
+	})
+})
@@ -0,0 +1,58 @@
+package outrunner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// flags that must never show up in argv, where ps and process
+// accounting can see them. bbl reads each from its BBL_* variable instead.
+var sensitiveFlags = map[string]bool{
+	"gcp-service-account-key":  true,
+	"aws-access-key-id":        true,
+	"aws-secret-access-key":    true,
+	"azure-client-secret":      true,
+	"vsphere-vcenter-password": true,
+	"openstack-password":       true,
+}
+
+// the only parts of our own environment bbl and terraform get to see
+var inheritedEnv = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"TMPDIR",
+	"LANG",
+	"LC_ALL",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+}
+
+func IsSensitiveFlag(flag string) bool {
+	return sensitiveFlags[flag]
+}
+
+// e.g. gcp-service-account-key -> BBL_GCP_SERVICE_ACCOUNT_KEY
+func EnvVarForFlag(flag string) string {
+	return "BBL_" + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+func childEnv(secrets map[string]string) []string {
+	env := []string{}
+	for _, key := range inheritedEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	for key, value := range secrets {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	return env
+}
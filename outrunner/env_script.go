@@ -0,0 +1,65 @@
+package outrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const JumpboxPrivateKeyFile = "jumpbox-private.key"
+
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// a set of variables for a cli that reaches the director's network through the jumpbox.
+// without a reachable jumpbox it still gets its other vars, just no proxy.
+type envScript struct {
+	vars          []envVar
+	proxyVar      string
+	jumpboxURL    string
+	jumpboxSSHKey string
+}
+
+func (e envScript) proxied() bool {
+	return e.jumpboxURL != "" && e.jumpboxSSHKey != ""
+}
+
+func (e envScript) proxy(keyPath string) string {
+	return fmt.Sprintf("ssh+socks5://jumpbox@%s?private-key=%s", e.jumpboxURL, keyPath)
+}
+
+// the key is found next to the script wherever the state dir ends up,
+// so the script stays valid after a get in a different container
+func (e envScript) script() string {
+	var b strings.Builder
+	b.WriteString("# generated by bbl-state-resource, source it from bash or zsh\n")
+	for _, v := range e.vars {
+		fmt.Fprintf(&b, "export %s=%s\n", v.Name, shellQuote(v.Value))
+	}
+	if e.proxied() {
+		b.WriteString(`env_dir="$(cd "$(dirname "${BASH_SOURCE:-$0}")" && pwd)"` + "\n")
+		fmt.Fprintf(&b, "export JUMPBOX_PRIVATE_KEY=\"${env_dir}\"/%s\n", JumpboxPrivateKeyFile)
+		fmt.Fprintf(&b, "export %s=%s\"${JUMPBOX_PRIVATE_KEY}\"\n", e.proxyVar, shellQuote(e.proxy("")))
+		b.WriteString("unset env_dir\n")
+	}
+	return b.String()
+}
+
+// the same variables as script, with the key path relative to the state dir
+func (e envScript) json() ([]byte, error) {
+	vars := map[string]string{}
+	for _, v := range e.vars {
+		vars[v.Name] = v.Value
+	}
+	if e.proxied() {
+		vars["JUMPBOX_PRIVATE_KEY"] = JumpboxPrivateKeyFile
+		vars[e.proxyVar] = e.proxy(JumpboxPrivateKeyFile)
+	}
+	return json.MarshalIndent(vars, "", "  ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
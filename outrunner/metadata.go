@@ -0,0 +1,25 @@
+package outrunner
+
+import "github.com/cloudfoundry/bbl-state-resource/concourse"
+
+// what the concourse ui shows about the environment. never credentials:
+// anyone who can see the pipeline can see these
+func Metadata(name string, state BblState) []concourse.MetadataField {
+	fields := []concourse.MetadataField{}
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, concourse.MetadataField{Name: name, Value: value})
+		}
+	}
+
+	add("name", name)
+	add("env_id", state.EnvID)
+	add("iaas", state.IAAS)
+	add("region", state.Region())
+	add("director_address", state.Director.Address)
+	add("jumpbox_url", state.Jumpbox.URL)
+	add("lb_type", state.LB.Type)
+	add("lb_domain", state.LB.Domain)
+	add("bbl_version", state.BBLVersion)
+	return fields
+}
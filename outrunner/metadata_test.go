@@ -0,0 +1,66 @@
+package outrunner_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+	It("describes the environment without its secrets", func() {
+		var state outrunner.BblState
+		err := json.Unmarshal([]byte(`{
+			"version": 14,
+			"bblVersion": "v8.4.92",
+			"iaas": "gcp",
+			"envID": "some-env-id",
+			"gcp": {"region": "us-east1", "zone": "us-east1-b"},
+			"jumpbox": {"url": "10.0.0.5:22"},
+			"bosh": {
+				"directorAddress": "https://10.0.0.6:25555",
+				"directorUsername": "admin",
+				"directorPassword": "some-director-password",
+				"directorSSLCA": "some-ca"
+			},
+			"lb": {"type": "cf", "domain": "cf.example.com", "cert": "some-cert", "key": "some-lb-key"}
+		}`), &state)
+		Expect(err).NotTo(HaveOccurred())
+
+		metadata := outrunner.Metadata("some-env-name", state)
+		Expect(metadata).To(Equal([]concourse.MetadataField{
+			{Name: "name", Value: "some-env-name"},
+			{Name: "env_id", Value: "some-env-id"},
+			{Name: "iaas", Value: "gcp"},
+			{Name: "region", Value: "us-east1"},
+			{Name: "director_address", Value: "https://10.0.0.6:25555"},
+			{Name: "jumpbox_url", Value: "10.0.0.5:22"},
+			{Name: "lb_type", Value: "cf"},
+			{Name: "lb_domain", Value: "cf.example.com"},
+			{Name: "bbl_version", Value: "v8.4.92"},
+		}))
+
+		contents, err := json.Marshal(metadata)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).NotTo(ContainSubstring("some-director-password"))
+		Expect(string(contents)).NotTo(ContainSubstring("some-lb-key"))
+	})
+
+	It("leaves out what the state doesn't have", func() {
+		Expect(outrunner.Metadata("some-env-name", outrunner.BblState{})).To(Equal([]concourse.MetadataField{
+			{Name: "name", Value: "some-env-name"},
+		}))
+	})
+
+	It("finds the region for the state's iaas", func() {
+		state := outrunner.BblState{IAAS: "aws"}
+		state.AWS.Region = "us-west-2"
+		state.GCP.Region = "ignored"
+		Expect(state.Region()).To(Equal("us-west-2"))
+
+		state.IAAS = "vsphere"
+		Expect(state.Region()).To(BeEmpty())
+	})
+})
@@ -1,37 +1,89 @@
 package outrunner
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
 )
 
 type stateDir interface {
 	Path() string
 	Read() (BblState, error)
 	JumpboxSSHKey() (string, error)
+	JumpboxHostKey() (string, error)
 	WriteInteropFiles(name string, config BoshDeploymentResourceConfig) error
+	WriteBoshEnv(env BoshEnv) error
+	CredhubCredentials() (CredhubCredentials, error)
+	WriteSSHConfig(config SSHConfig) error
+	TerraformOutputs() (TerraformOutputs, error)
+	WriteTerraformOutputs(outputs TerraformOutputs) error
+	WriteDNSRecords(records []DNSRecord) error
+	WriteCredhubEnv(env CredhubEnv) error
 	ExpungeInteropFiles() error
 }
 
-func RunBBL(name string, stateDir stateDir, command string, flags map[string]interface{}) error {
-	return RunInjected(bblRunner, name, stateDir, command, flags)
+func RunBBL(ctx context.Context, gracePeriod time.Duration, name string, stateDir stateDir, command string, flags concourse.Args) error {
+	return RunInjected(ctx, BBLRunner{Path: "bbl", GracePeriod: gracePeriod}, name, stateDir, command, flags)
+}
+
+func RunInjected(ctx context.Context, r commandRunner, name string, stateDir stateDir, command string, flags concourse.Args) error {
+	args, secrets, err := bblArgs(name, stateDir, flags)
+	if err != nil {
+		return err
+	}
+
+	err = r.Run(ctx, command, args, childEnv(secrets))
+	SyncInteropFiles(stateDir)
+	if err != nil {
+		return fmt.Errorf("failed running bbl %s --state-dir=%s <sensitive flags omitted>: %w", command, stateDir.Path(), err)
+	}
+	return nil
 }
 
-func RunInjected(r commandRunner, name string, stateDir stateDir, command string, flags map[string]interface{}) error {
+// the args for bbl, and the sensitive flags that have to go in its environment instead
+func bblArgs(name string, stateDir stateDir, flags concourse.Args) ([]string, map[string]string, error) {
 	args := []string{}
 	args = append(args, fmt.Sprintf("--name=%s", name))
 	args = append(args, fmt.Sprintf("--state-dir=%s", stateDir.Path()))
-	for key, value := range flags {
-		args = append(args, fmt.Sprintf("--%s=%s", key, value))
+	secrets := map[string]string{}
+	for _, key := range flags.Names() {
+		value := flags[key]
+		if IsSensitiveFlag(key) {
+			if value.Switch || len(value.Values) > 1 {
+				return nil, nil, fmt.Errorf("%s must be a single value", key)
+			}
+			if len(value.Values) == 1 {
+				secrets[EnvVarForFlag(key)] = value.Values[0]
+			}
+			continue
+		}
+		args = append(args, value.Flags(key)...)
 	}
+	return args, secrets, nil
+}
 
-	err := r.Run(command, args)
-	SyncInteropFiles(stateDir)
+// the bbl invocation RunInjected would make, safe to print
+func DescribeInvocation(name string, stateDir stateDir, command string, flags concourse.Args) (string, error) {
+	args, secrets, err := bblArgs(name, stateDir, flags)
 	if err != nil {
-		return fmt.Errorf("failed running bbl %s --state-dir=%s <sensitive flags omitted>: %s", command, stateDir.Path(), err)
+		return "", err
 	}
-	return nil
+
+	envVars := make([]string, 0, len(secrets))
+	for envVar := range secrets {
+		envVars = append(envVars, fmt.Sprintf("%s=<redacted>", envVar))
+	}
+	sort.Strings(envVars)
+
+	words := append(envVars, "bbl", "-n", command)
+	return strings.Join(append(words, args...), " "), nil
 }
 
 // best effort, log aggressively
@@ -66,21 +118,112 @@ func SyncInteropFiles(stateDir stateDir) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to write interop files: %s\n", err)
 	}
+
+	outputs, err := stateDir.TerraformOutputs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed reading terraform outputs: %s\n", err)
+	} else {
+		err = stateDir.WriteTerraformOutputs(outputs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write terraform outputs: %s\n", err)
+		}
+
+		err = stateDir.WriteDNSRecords(DNSRecords(bblState.LB, outputs))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write dns records: %s\n", err)
+		}
+	}
+
+	if bblState.Jumpbox.URL != "" && sshKey != "" {
+		hostKey, err := stateDir.JumpboxHostKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed reading jumpbox host key: %s\n", err)
+		}
+		err = stateDir.WriteSSHConfig(NewSSHConfig(bblState, sshKey, hostKey))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write ssh config: %s\n", err)
+		}
+	}
+
+	if !bblState.HasDirector() {
+		return // nothing for bosh to talk to
+	}
+	err = stateDir.WriteBoshEnv(NewBoshEnv(bblState, sshKey))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write bosh env: %s\n", err)
+	}
+
+	creds, err := stateDir.CredhubCredentials()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed reading credhub credentials: %s\n", err)
+		return
+	}
+	err = stateDir.WriteCredhubEnv(NewCredhubEnv(bblState, creds, sshKey))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write credhub env: %s\n", err)
+	}
 }
 
 type commandRunner interface {
-	Run(string, []string) error
+	Run(ctx context.Context, command string, args []string, env []string) error
 }
 
-type bblRunnerT struct{}
+const DefaultAbortGracePeriod = time.Minute
 
-var bblRunner = bblRunnerT{}
+type BBLRunner struct {
+	Path string
+	// how long bbl gets to save its state after the put is aborted
+	GracePeriod time.Duration
+}
 
-func (bblRunnerT) Run(command string, args []string) error {
+// runs bbl in its own process group. when ctx is done the whole group,
+// terraform included, is interrupted and given GracePeriod to write
+// its state before being killed.
+// env is bbl's entire environment, nothing is inherited
+func (r BBLRunner) Run(ctx context.Context, command string, args []string, env []string) error {
 	args = append([]string{"-n", command}, args...)
-	cmd := exec.Command("bbl", args...)
+	cmd := exec.Command(r.Path, args...)
+	cmd.Env = env
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	gracePeriod := r.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultAbortGracePeriod
+	}
+
+	fmt.Fprintf(os.Stderr, "aborting: interrupting bbl and waiting up to %s for it to save its state...\n", gracePeriod)
+	// exactly one interrupt: terraform treats a second one as "exit immediately"
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return fmt.Errorf("aborted (%s), bbl exited: %v", ctx.Err(), err)
+	case <-timer.C:
+	}
 
-	return cmd.Run()
+	fmt.Fprintf(os.Stderr, "bbl did not exit within %s, killing it\n", gracePeriod)
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	<-done
+	return fmt.Errorf("aborted (%s), bbl killed after %s", ctx.Err(), gracePeriod)
 }
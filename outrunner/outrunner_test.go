@@ -1,8 +1,14 @@
 package outrunner_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/cloudfoundry/bbl-state-resource/concourse"
 	"github.com/cloudfoundry/bbl-state-resource/fakes"
@@ -31,15 +37,15 @@ var _ = Describe("Run", func() {
 		BeforeEach(func() {
 			params = concourse.OutParams{
 				Command: "up",
-				Args: map[string]interface{}{
-					"lb-key":  "some-lb-key",
-					"lb-cert": "some-lb-cert",
+				Args: concourse.Args{
+					"lb-key":  concourse.StringArg("some-lb-key"),
+					"lb-cert": concourse.StringArg("some-lb-cert"),
 				},
 			}
 		})
 
 		It("runs bbl up with the appropriate inputs", func() {
-			err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(commandRunner.RunCall.Receives.Command).To(Equal("up"))
@@ -52,7 +58,7 @@ var _ = Describe("Run", func() {
 		})
 
 		It("writes out the correct metadata for interoperation with other concourse resources", func() {
-			err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(stateDir.WriteInteropFilesCall.CallCount).To(Equal(1))
@@ -65,6 +71,207 @@ var _ = Describe("Run", func() {
 				}),
 			)
 		})
+
+		It("writes out a bosh env for the new director", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteBoshEnvCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteBoshEnvCall.Receives.Env).To(Equal(outrunner.BoshEnv{
+				Environment:   "some-director",
+				JumpboxURL:    "some-jumpbox",
+				JumpboxSSHKey: "some-ssh-key",
+			}))
+		})
+
+		It("writes out the terraform outputs", func() {
+			stateDir.TerraformOutputsCall.Returns.Outputs = outrunner.TerraformOutputs{"network_name": "some-env-network"}
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteTerraformOutputsCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteTerraformOutputsCall.Receives.Outputs).To(Equal(outrunner.TerraformOutputs{"network_name": "some-env-network"}))
+		})
+
+		It("writes out the dns records for the lb domain", func() {
+			stateDir.ReadCall.Returns.BblState.LB = outrunner.LB{Type: "concourse", Domain: "ci.example.com"}
+			stateDir.TerraformOutputsCall.Returns.Outputs = outrunner.TerraformOutputs{"concourse_lb_ip": "35.1.2.3"}
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteDNSRecordsCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteDNSRecordsCall.Receives.Records).To(Equal([]outrunner.DNSRecord{
+				{Domain: "ci.example.com", Type: "A", Value: "35.1.2.3"},
+			}))
+		})
+
+		It("clears out the terraform outputs when terraform has none", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteTerraformOutputsCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteTerraformOutputsCall.Receives.Outputs).To(BeEmpty())
+		})
+
+		It("writes out an ssh config for the jumpbox", func() {
+			stateDir.JumpboxHostKeyCall.Returns.Key = "some-host-key"
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteSSHConfigCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteSSHConfigCall.Receives.Config).To(Equal(outrunner.SSHConfig{
+				JumpboxURL:    "some-jumpbox",
+				JumpboxSSHKey: "some-ssh-key",
+				HostKey:       "some-host-key",
+			}))
+		})
+
+		It("doesn't write an ssh config without a jumpbox key", func() {
+			stateDir.JumpboxSSHKeyCall.Returns.Key = ""
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteSSHConfigCall.CallCount).To(Equal(0))
+		})
+
+		It("writes out a credhub env for the director's credhub", func() {
+			stateDir.CredhubCredentialsCall.Returns.Credentials.ClientSecret = "some-credhub-secret"
+			stateDir.ReadCall.Returns.BblState.Director.Address = "https://10.0.0.6:25555"
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteCredhubEnvCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteCredhubEnvCall.Receives.Env).To(Equal(outrunner.CredhubEnv{
+				Server:        "https://10.0.0.6:8844",
+				Client:        "credhub-admin",
+				Secret:        "some-credhub-secret",
+				JumpboxURL:    "some-jumpbox",
+				JumpboxSSHKey: "some-ssh-key",
+			}))
+		})
+
+		It("skips the credhub env when the director vars store can't be read", func() {
+			stateDir.CredhubCredentialsCall.Returns.Error = errors.New("some-error")
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteBoshEnvCall.CallCount).To(Equal(1))
+			Expect(stateDir.WriteCredhubEnvCall.CallCount).To(Equal(0))
+		})
+
+		It("doesn't write a bosh env before there is a director", func() {
+			stateDir.ReadCall.Returns.BblState.Director.Address = ""
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stateDir.WriteBoshEnvCall.CallCount).To(Equal(0))
+			Expect(stateDir.WriteCredhubEnvCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("with secrets", func() {
+		var flags concourse.Args
+		BeforeEach(func() {
+			var err error
+			flags, err = outrunner.AppendSourceFlags(concourse.Args{}, concourse.Source{
+				IAAS:                 "gcp",
+				GCPServiceAccountKey: `{"private_key": "some-private-key"}`,
+				GCPRegion:            "some-region",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("SOME_UNRELATED_PARENT_SECRET", "durian")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("SOME_UNRELATED_PARENT_SECRET")
+		})
+
+		It("never puts them in bbl's args", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, "up", flags)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, arg := range commandRunner.RunCall.Receives.Args {
+				Expect(arg).NotTo(ContainSubstring("some-private-key"))
+			}
+			Expect(commandRunner.RunCall.Receives.Args).To(ContainElement("--gcp-region=some-region"))
+		})
+
+		It("passes them to bbl through its environment", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, "up", flags)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commandRunner.RunCall.Receives.Env).To(ContainElement(`BBL_GCP_SERVICE_ACCOUNT_KEY={"private_key": "some-private-key"}`))
+		})
+
+		It("refuses to pass a list or switch through the environment", func() {
+			flags["gcp-service-account-key"] = concourse.Arg{Values: []string{"a", "b"}}
+
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, "up", flags)
+			Expect(err).To(MatchError("gcp-service-account-key must be a single value"))
+			Expect(commandRunner.RunCall.CallCount).To(Equal(0))
+		})
+
+		It("describes the invocation without them", func() {
+			invocation, err := outrunner.DescribeInvocation("some-env-name", stateDir, "up", flags)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(invocation).To(Equal("BBL_GCP_SERVICE_ACCOUNT_KEY=<redacted> " +
+				"bbl -n up --name=some-env-name --state-dir=some-bbl-state-dir --gcp-region=some-region --iaas=gcp"))
+			Expect(commandRunner.RunCall.CallCount).To(Equal(0))
+		})
+
+		It("doesn't hand bbl the rest of our environment", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, "up", flags)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commandRunner.RunCall.Receives.Env).To(ContainElement(HavePrefix("PATH=")))
+			Expect(commandRunner.RunCall.Receives.Env).NotTo(ContainElement(HavePrefix("SOME_UNRELATED_PARENT_SECRET=")))
+		})
+	})
+
+	Context("with typed args", func() {
+		var params concourse.OutParams
+		BeforeEach(func() {
+			err := json.Unmarshal([]byte(`{
+				"command": "cleanup-leftovers",
+				"args": {
+					"filter": ["env-a", "env-b"],
+					"dry-run": true,
+					"debug": false,
+					"some-number": 3
+				}
+			}`), &params)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("renders switches, repeated flags and numbers in a stable order", func() {
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commandRunner.RunCall.Receives.Args).To(Equal([]string{
+				"--name=some-env-name",
+				"--state-dir=some-bbl-state-dir",
+				"--dry-run",
+				"--filter=env-a",
+				"--filter=env-b",
+				"--some-number=3",
+			}))
+		})
+
+		It("rejects values that can't be flags", func() {
+			err := json.Unmarshal([]byte(`{"args": {"lb-cert": {"nested": "map"}}}`), &params)
+			Expect(err).To(MatchError(ContainSubstring("args.lb-cert: unsupported value")))
+
+			err = json.Unmarshal([]byte(`{"args": {"filter": [true]}}`), &params)
+			Expect(err).To(MatchError(ContainSubstring("args.filter: list items must be strings or numbers")))
+		})
 	})
 
 	Context("without optional args", func() {
@@ -72,12 +279,12 @@ var _ = Describe("Run", func() {
 		BeforeEach(func() {
 			params = concourse.OutParams{
 				Command: "up",
-				Args:    map[string]interface{}{},
+				Args:    concourse.Args{},
 			}
 		})
 
 		It("omits the corresponding flags", func() {
-			err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+			err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(commandRunner.RunCall.Receives.Command).To(Equal("up"))
@@ -93,7 +300,7 @@ var _ = Describe("Run", func() {
 			})
 
 			It("errors", func() {
-				err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+				err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 				Expect(err).To(MatchError("failed running bbl up --state-dir=some-bbl-state-dir <sensitive flags omitted>: some-error"))
 			})
 		})
@@ -104,7 +311,7 @@ var _ = Describe("Run", func() {
 			})
 
 			It("does not error", func() {
-				err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+				err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
@@ -115,7 +322,7 @@ var _ = Describe("Run", func() {
 			})
 
 			It("does not error, but does expunge interop files", func() {
-				err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+				err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(stateDir.ExpungeInteropFilesCall.CallCount).To(Equal(1))
 			})
@@ -126,7 +333,7 @@ var _ = Describe("Run", func() {
 				})
 
 				It("does not error, and does not try to continue", func() {
-					err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+					err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 					Expect(err).NotTo(HaveOccurred())
 					Expect(stateDir.WriteInteropFilesCall.CallCount).To(Equal(0))
 					Expect(stateDir.JumpboxSSHKeyCall.CallCount).To(Equal(0))
@@ -140,9 +347,102 @@ var _ = Describe("Run", func() {
 			})
 
 			It("does not error", func() {
-				err := outrunner.RunInjected(commandRunner, "some-env-name", stateDir, params.Command, params.Args)
+				err := outrunner.RunInjected(context.Background(), commandRunner, "some-env-name", stateDir, params.Command, params.Args)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
 	})
 })
+
+var _ = Describe("BBLRunner", func() {
+	var (
+		tmpDir string
+		runner outrunner.BBLRunner
+		env    []string
+	)
+
+	writeFakeBBL := func(script string) {
+		path := filepath.Join(tmpDir, "bbl")
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)
+		Expect(err).NotTo(HaveOccurred())
+		runner = outrunner.BBLRunner{Path: path, GracePeriod: 2 * time.Second}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+		env = []string{"PATH=" + os.Getenv("PATH")}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	It("runs bbl with exactly the environment it's given", func() {
+		writeFakeBBL(fmt.Sprintf(`env > %s/env`, tmpDir))
+		env = append(env, "BBL_GCP_SERVICE_ACCOUNT_KEY=some-key")
+
+		err := runner.Run(context.Background(), "up", nil, env)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "env"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("BBL_GCP_SERVICE_ACCOUNT_KEY=some-key\n"))
+		Expect(string(contents)).NotTo(ContainSubstring("HOME="))
+	})
+
+	It("runs bbl non-interactively with the command and args", func() {
+		writeFakeBBL(fmt.Sprintf(`printf '%%s\n' "$*" > %s/args`, tmpDir))
+
+		err := runner.Run(context.Background(), "up", []string{"--name=some-env-name"}, env)
+		Expect(err).NotTo(HaveOccurred())
+
+		args, err := ioutil.ReadFile(filepath.Join(tmpDir, "args"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(args)).To(Equal("-n up --name=some-env-name\n"))
+	})
+
+	It("returns bbl's failures", func() {
+		writeFakeBBL("exit 3")
+
+		err := runner.Run(context.Background(), "up", nil, env)
+		Expect(err).To(MatchError("exit status 3"))
+	})
+
+	Context("when the put is aborted", func() {
+		It("interrupts bbl and waits for it to save its state", func() {
+			writeFakeBBL(fmt.Sprintf(`trap 'echo saved > %s/saved; exit 1' INT
+touch %s/started
+while true; do sleep 0.1; done`, tmpDir, tmpDir))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				defer GinkgoRecover()
+				Eventually(filepath.Join(tmpDir, "started")).Should(BeAnExistingFile())
+				cancel()
+			}()
+
+			err := runner.Run(ctx, "up", nil, env)
+			Expect(err).To(MatchError(ContainSubstring("aborted (context canceled), bbl exited")))
+			Expect(filepath.Join(tmpDir, "saved")).To(BeAnExistingFile())
+		})
+
+		It("kills bbl if it doesn't exit within the grace period", func() {
+			writeFakeBBL(fmt.Sprintf(`trap '' INT
+touch %s/started
+while true; do sleep 0.1; done`, tmpDir))
+			runner.GracePeriod = 200 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				defer GinkgoRecover()
+				Eventually(filepath.Join(tmpDir, "started")).Should(BeAnExistingFile())
+				cancel()
+			}()
+
+			err := runner.Run(ctx, "up", nil, env)
+			Expect(err).To(MatchError(ContainSubstring("bbl killed after 200ms")))
+		})
+	})
+})
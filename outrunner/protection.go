@@ -0,0 +1,87 @@
+package outrunner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+// object metadata recording whether destructive commands need confirm_name,
+// and which put last confirmed one
+const (
+	ProtectedMetadataKey          = "protected"
+	ProtectionOverrideMetadataKey = "protection-override"
+)
+
+func isProtected(metadata map[string]string) bool {
+	return metadata[ProtectedMetadataKey] == "true"
+}
+
+// refuses destructive commands, and unprotecting, unless params.ConfirmName is name.
+// true when the put overrides the protection
+func CheckProtection(command Command, name string, params concourse.OutParams, metadata map[string]string) (bool, error) {
+	if !isProtected(metadata) {
+		return false, nil
+	}
+
+	unprotecting := params.Protected != nil && !*params.Protected
+	if !command.Destructive && !unprotecting {
+		return false, nil
+	}
+
+	action := fmt.Sprintf("bbl %s", command.Name)
+	if unprotecting {
+		action = "protected: false"
+	}
+
+	if params.ConfirmName == "" {
+		return false, fmt.Errorf("%s is protected: %s requires confirm_name: %s", name, action, name)
+	}
+	if params.ConfirmName != name {
+		return false, fmt.Errorf("%s is protected: confirm_name %q doesn't match", name, params.ConfirmName)
+	}
+	return true, nil
+}
+
+// the metadata the put's new version should have: protection is carried
+// forward from the previous version unless params.Protected changes it
+func NextMetadata(previous map[string]string, params concourse.OutParams, command Command, override bool) map[string]string {
+	metadata := map[string]string{}
+	if isProtected(previous) {
+		metadata[ProtectedMetadataKey] = "true"
+	}
+	if params.Protected != nil {
+		metadata[ProtectedMetadataKey] = fmt.Sprintf("%t", *params.Protected)
+	}
+
+	if override {
+		record := fmt.Sprintf("bbl %s confirmed at %s", command.Name, time.Now().UTC().Format(time.RFC3339))
+		if build := buildDescription(); build != "" {
+			record = fmt.Sprintf("%s by %s", record, build)
+		}
+		metadata[ProtectionOverrideMetadataKey] = record
+	}
+	return metadata
+}
+
+// pipeline/job #build, from the env concourse gives puts
+func buildDescription() string {
+	var parts []string
+	for _, envVar := range []string{"BUILD_TEAM_NAME", "BUILD_PIPELINE_NAME", "BUILD_JOB_NAME"} {
+		if value := os.Getenv(envVar); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	description := strings.Join(parts, "/")
+	if build := os.Getenv("BUILD_NAME"); build != "" {
+		description = fmt.Sprintf("%s #%s", description, build)
+	}
+	return description
+}
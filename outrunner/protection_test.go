@@ -0,0 +1,94 @@
+package outrunner_test
+
+import (
+	"os"
+
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Protection", func() {
+	var (
+		protected   map[string]string
+		unprotected map[string]string
+		down        outrunner.Command
+		up          outrunner.Command
+	)
+
+	BeforeEach(func() {
+		protected = map[string]string{"protected": "true", "status": "complete"}
+		unprotected = map[string]string{"status": "complete"}
+		down = outrunner.Commands["down"]
+		up = outrunner.Commands["up"]
+	})
+
+	Describe("CheckProtection", func() {
+		It("lets anything run against an unprotected environment", func() {
+			override, err := outrunner.CheckProtection(down, "some-env", concourse.OutParams{}, unprotected)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(override).To(BeFalse())
+		})
+
+		It("lets non-destructive commands run against a protected environment", func() {
+			override, err := outrunner.CheckProtection(up, "some-env", concourse.OutParams{}, protected)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(override).To(BeFalse())
+		})
+
+		It("refuses destructive commands without confirm_name", func() {
+			_, err := outrunner.CheckProtection(down, "some-env", concourse.OutParams{}, protected)
+			Expect(err).To(MatchError("some-env is protected: bbl down requires confirm_name: some-env"))
+
+			_, err = outrunner.CheckProtection(outrunner.Commands["cleanup-leftovers"], "some-env", concourse.OutParams{}, protected)
+			Expect(err).To(MatchError("some-env is protected: bbl cleanup-leftovers requires confirm_name: some-env"))
+		})
+
+		It("refuses destructive commands when confirm_name doesn't match", func() {
+			_, err := outrunner.CheckProtection(down, "some-env", concourse.OutParams{ConfirmName: "some-other-env"}, protected)
+			Expect(err).To(MatchError(`some-env is protected: confirm_name "some-other-env" doesn't match`))
+		})
+
+		It("overrides the protection when confirm_name matches", func() {
+			override, err := outrunner.CheckProtection(down, "some-env", concourse.OutParams{ConfirmName: "some-env"}, protected)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(override).To(BeTrue())
+		})
+
+		It("requires confirm_name to unprotect", func() {
+			no := false
+			_, err := outrunner.CheckProtection(up, "some-env", concourse.OutParams{Protected: &no}, protected)
+			Expect(err).To(MatchError("some-env is protected: protected: false requires confirm_name: some-env"))
+		})
+	})
+
+	Describe("NextMetadata", func() {
+		AfterEach(func() {
+			os.Unsetenv("BUILD_PIPELINE_NAME")
+			os.Unsetenv("BUILD_JOB_NAME")
+			os.Unsetenv("BUILD_NAME")
+		})
+
+		It("carries protection forward, but not the previous status", func() {
+			Expect(outrunner.NextMetadata(protected, concourse.OutParams{}, up, false)).To(Equal(map[string]string{"protected": "true"}))
+			Expect(outrunner.NextMetadata(unprotected, concourse.OutParams{}, up, false)).To(BeEmpty())
+		})
+
+		It("lets the put change the protection", func() {
+			yes, no := true, false
+			Expect(outrunner.NextMetadata(unprotected, concourse.OutParams{Protected: &yes}, up, false)).To(HaveKeyWithValue("protected", "true"))
+			Expect(outrunner.NextMetadata(protected, concourse.OutParams{Protected: &no}, up, true)).To(HaveKeyWithValue("protected", "false"))
+		})
+
+		It("records overrides", func() {
+			os.Setenv("BUILD_PIPELINE_NAME", "some-pipeline")
+			os.Setenv("BUILD_JOB_NAME", "some-job")
+			os.Setenv("BUILD_NAME", "42")
+
+			metadata := outrunner.NextMetadata(protected, concourse.OutParams{ConfirmName: "some-env"}, down, true)
+			Expect(metadata).To(HaveKeyWithValue("protected", "true"))
+			Expect(metadata["protection-override"]).To(MatchRegexp(`^bbl down confirmed at \S+ by some-pipeline/some-job #42$`))
+		})
+	})
+})
@@ -1,19 +1,96 @@
 package outrunner
 
-import "github.com/cloudfoundry/bbl-state-resource/concourse"
+import (
+	"fmt"
+	"strings"
 
-func AppendSourceFlags(flags map[string]interface{}, source concourse.Source) map[string]interface{} {
+	"github.com/cloudfoundry/bbl-state-resource/concourse"
+)
+
+// only the flags for source.IAAS are appended, and all of its
+// required credentials must be present
+func AppendSourceFlags(flags concourse.Args, source concourse.Source) (concourse.Args, error) {
 	if flags == nil {
-		flags = map[string]interface{}{}
+		flags = concourse.Args{}
+	}
+
+	var missing []string
+	required := func(field, flag, value string) {
+		if value == "" {
+			missing = append(missing, field)
+			return
+		}
+		flags[flag] = concourse.StringArg(value)
 	}
-	flags["iaas"] = source.IAAS
-	flags["gcp-service-account-key"] = source.GCPServiceAccountKey
-	flags["gcp-region"] = source.GCPRegion
-	if source.LBType != "" {
-		flags["lb-type"] = source.LBType
+	optional := func(flag, value string) {
+		if value != "" {
+			flags[flag] = concourse.StringArg(value)
+		}
 	}
-	if source.LBDomain != "" {
-		flags["lb-domain"] = source.LBDomain
+
+	flags["iaas"] = concourse.StringArg(source.IAAS)
+	switch source.IAAS {
+	case "gcp":
+		required("gcp_service_account_key", "gcp-service-account-key", source.GCPServiceAccountKey)
+		required("gcp_region", "gcp-region", source.GCPRegion)
+	case "aws":
+		required("aws_access_key_id", "aws-access-key-id", source.AWSAccessKeyID)
+		required("aws_secret_access_key", "aws-secret-access-key", source.AWSSecretAccessKey)
+		required("aws_region", "aws-region", source.AWSRegion)
+		optional("aws-assume-role", source.AWSAssumeRole)
+	case "azure":
+		azure := concourse.Azure{}
+		if source.Azure != nil {
+			azure = *source.Azure
+		}
+		required("azure.client_id", "azure-client-id", azure.ClientID)
+		required("azure.client_secret", "azure-client-secret", azure.ClientSecret)
+		required("azure.tenant_id", "azure-tenant-id", azure.TenantID)
+		required("azure.subscription_id", "azure-subscription-id", azure.SubscriptionID)
+		required("azure.region", "azure-region", azure.Region)
+	case "vsphere":
+		vsphere := concourse.VSphere{}
+		if source.VSphere != nil {
+			vsphere = *source.VSphere
+		}
+		required("vsphere.vcenter_user", "vsphere-vcenter-user", vsphere.VCenterUser)
+		required("vsphere.vcenter_password", "vsphere-vcenter-password", vsphere.VCenterPassword)
+		required("vsphere.vcenter_ip", "vsphere-vcenter-ip", vsphere.VCenterIP)
+		required("vsphere.vcenter_dc", "vsphere-vcenter-dc", vsphere.VCenterDC)
+		required("vsphere.vcenter_cluster", "vsphere-vcenter-cluster", vsphere.VCenterCluster)
+		required("vsphere.vcenter_rp", "vsphere-vcenter-rp", vsphere.VCenterRP)
+		required("vsphere.vcenter_ds", "vsphere-vcenter-ds", vsphere.VCenterDS)
+		required("vsphere.network", "vsphere-network", vsphere.Network)
+		required("vsphere.subnet_cidr", "vsphere-subnet-cidr", vsphere.SubnetCIDR)
+		optional("vsphere-vcenter-disks", vsphere.VCenterDisks)
+		optional("vsphere-vcenter-templates", vsphere.VCenterTemplates)
+		optional("vsphere-vcenter-vms", vsphere.VCenterVMs)
+	case "openstack":
+		openstack := concourse.OpenStack{}
+		if source.OpenStack != nil {
+			openstack = *source.OpenStack
+		}
+		required("openstack.auth_url", "openstack-auth-url", openstack.AuthURL)
+		required("openstack.az", "openstack-az", openstack.AZ)
+		required("openstack.network_id", "openstack-network-id", openstack.NetworkID)
+		required("openstack.network_name", "openstack-network-name", openstack.NetworkName)
+		required("openstack.username", "openstack-username", openstack.Username)
+		required("openstack.password", "openstack-password", openstack.Password)
+		required("openstack.project", "openstack-project", openstack.Project)
+		required("openstack.domain", "openstack-domain", openstack.Domain)
+		optional("openstack-region", openstack.Region)
+		optional("openstack-cacert-file", openstack.CACertFile)
+		flags["openstack-insecure"] = concourse.BoolArg(openstack.Insecure)
+	case "":
+		return nil, fmt.Errorf("missing required source field: iaas")
+	default:
+		return nil, fmt.Errorf("unsupported iaas %q", source.IAAS)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required source fields for iaas %s: %s", source.IAAS, strings.Join(missing, ", "))
 	}
-	return flags
+
+	optional("lb-type", source.LBType)
+	optional("lb-domain", source.LBDomain)
+	return flags, nil
 }
@@ -9,14 +9,14 @@ import (
 
 var _ = Describe("AppendSourceFlags", func() {
 	var (
-		yeOldeFlags map[string]interface{}
+		yeOldeFlags concourse.Args
 		source      concourse.Source
 	)
 
 	BeforeEach(func() {
-		yeOldeFlags = map[string]interface{}{
-			"lb-cert": "/path/to/lb/cert",
-			"lb-key":  "/path/to/lb/key",
+		yeOldeFlags = concourse.Args{
+			"lb-cert": concourse.StringArg("/path/to/lb/cert"),
+			"lb-key":  concourse.StringArg("/path/to/lb/key"),
 		}
 	})
 
@@ -29,15 +29,16 @@ var _ = Describe("AppendSourceFlags", func() {
 			LBType:               "cf",
 			LBDomain:             "cf.example.com",
 		}
-		flags := outrunner.AppendSourceFlags(yeOldeFlags, source)
-
-		Expect(flags).To(HaveKeyWithValue("iaas", "gcp"))
-		Expect(flags).To(HaveKeyWithValue("gcp-service-account-key", "some-service-account-key"))
-		Expect(flags).To(HaveKeyWithValue("gcp-region", "some-region"))
-		Expect(flags).To(HaveKeyWithValue("lb-type", "cf"))
-		Expect(flags).To(HaveKeyWithValue("lb-domain", "cf.example.com"))
-		Expect(flags).To(HaveKeyWithValue("lb-cert", "/path/to/lb/cert"))
-		Expect(flags).To(HaveKeyWithValue("lb-key", "/path/to/lb/key"))
+		flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(flags).To(HaveKeyWithValue("iaas", concourse.StringArg("gcp")))
+		Expect(flags).To(HaveKeyWithValue("gcp-service-account-key", concourse.StringArg("some-service-account-key")))
+		Expect(flags).To(HaveKeyWithValue("gcp-region", concourse.StringArg("some-region")))
+		Expect(flags).To(HaveKeyWithValue("lb-type", concourse.StringArg("cf")))
+		Expect(flags).To(HaveKeyWithValue("lb-domain", concourse.StringArg("cf.example.com")))
+		Expect(flags).To(HaveKeyWithValue("lb-cert", concourse.StringArg("/path/to/lb/cert")))
+		Expect(flags).To(HaveKeyWithValue("lb-key", concourse.StringArg("/path/to/lb/key")))
 		Expect(flags).NotTo(HaveKey("bucket"))
 	})
 
@@ -49,16 +50,170 @@ var _ = Describe("AppendSourceFlags", func() {
 				GCPServiceAccountKey: "some-service-account-key",
 				GCPRegion:            "some-region",
 			}
-			flags := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(flags).To(HaveKeyWithValue("iaas", "gcp"))
-			Expect(flags).To(HaveKeyWithValue("gcp-service-account-key", "some-service-account-key"))
-			Expect(flags).To(HaveKeyWithValue("gcp-region", "some-region"))
+			Expect(flags).To(HaveKeyWithValue("iaas", concourse.StringArg("gcp")))
+			Expect(flags).To(HaveKeyWithValue("gcp-service-account-key", concourse.StringArg("some-service-account-key")))
+			Expect(flags).To(HaveKeyWithValue("gcp-region", concourse.StringArg("some-region")))
 			Expect(flags).NotTo(HaveKey("lb-type"))
 			Expect(flags).NotTo(HaveKey("lb-domain"))
-			Expect(flags).To(HaveKeyWithValue("lb-cert", "/path/to/lb/cert"))
-			Expect(flags).To(HaveKeyWithValue("lb-key", "/path/to/lb/key"))
+			Expect(flags).To(HaveKeyWithValue("lb-cert", concourse.StringArg("/path/to/lb/cert")))
+			Expect(flags).To(HaveKeyWithValue("lb-key", concourse.StringArg("/path/to/lb/key")))
 			Expect(flags).NotTo(HaveKey("bucket"))
 		})
 	})
+
+	Context("when the iaas is aws", func() {
+		BeforeEach(func() {
+			source = concourse.Source{
+				Bucket:             "dont-flaggify-this-bucket!",
+				IAAS:               "aws",
+				AWSAccessKeyID:     "some-access-key-id",
+				AWSSecretAccessKey: "some-secret-access-key",
+				AWSRegion:          "some-region",
+			}
+		})
+
+		It("gets ye aws flags and no gcp ones", func() {
+			source.GCPServiceAccountKey = "some-service-account-key-for-the-bucket"
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flags).To(HaveKeyWithValue("iaas", concourse.StringArg("aws")))
+			Expect(flags).To(HaveKeyWithValue("aws-access-key-id", concourse.StringArg("some-access-key-id")))
+			Expect(flags).To(HaveKeyWithValue("aws-secret-access-key", concourse.StringArg("some-secret-access-key")))
+			Expect(flags).To(HaveKeyWithValue("aws-region", concourse.StringArg("some-region")))
+			Expect(flags).NotTo(HaveKey("aws-assume-role"))
+			Expect(flags).NotTo(HaveKey("gcp-service-account-key"))
+			Expect(flags).NotTo(HaveKey("gcp-region"))
+		})
+
+		It("assumes a role when asked to", func() {
+			source.AWSAssumeRole = "arn:aws:iam::123456789012:role/bbl"
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flags).To(HaveKeyWithValue("aws-assume-role", concourse.StringArg("arn:aws:iam::123456789012:role/bbl")))
+		})
+
+		It("names any missing credentials", func() {
+			source.AWSAccessKeyID = ""
+			source.AWSRegion = ""
+			_, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).To(MatchError("missing required source fields for iaas aws: aws_access_key_id, aws_region"))
+		})
+	})
+
+	Context("when the iaas is azure", func() {
+		It("gets ye azure flags", func() {
+			source = concourse.Source{
+				IAAS: "azure",
+				Azure: &concourse.Azure{
+					ClientID:       "some-client-id",
+					ClientSecret:   "some-client-secret",
+					TenantID:       "some-tenant-id",
+					SubscriptionID: "some-subscription-id",
+					Region:         "some-region",
+				},
+			}
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flags).To(HaveKeyWithValue("iaas", concourse.StringArg("azure")))
+			Expect(flags).To(HaveKeyWithValue("azure-client-id", concourse.StringArg("some-client-id")))
+			Expect(flags).To(HaveKeyWithValue("azure-client-secret", concourse.StringArg("some-client-secret")))
+			Expect(flags).To(HaveKeyWithValue("azure-tenant-id", concourse.StringArg("some-tenant-id")))
+			Expect(flags).To(HaveKeyWithValue("azure-subscription-id", concourse.StringArg("some-subscription-id")))
+			Expect(flags).To(HaveKeyWithValue("azure-region", concourse.StringArg("some-region")))
+		})
+
+		It("names every missing field when the section is missing", func() {
+			_, err := outrunner.AppendSourceFlags(yeOldeFlags, concourse.Source{IAAS: "azure"})
+			Expect(err).To(MatchError("missing required source fields for iaas azure: azure.client_id, azure.client_secret, azure.tenant_id, azure.subscription_id, azure.region"))
+		})
+	})
+
+	Context("when the iaas is vsphere", func() {
+		BeforeEach(func() {
+			source = concourse.Source{
+				IAAS: "vsphere",
+				VSphere: &concourse.VSphere{
+					VCenterUser:     "some-user",
+					VCenterPassword: "some-password",
+					VCenterIP:       "10.0.0.5",
+					VCenterDC:       "some-dc",
+					VCenterCluster:  "some-cluster",
+					VCenterRP:       "some-rp",
+					VCenterDS:       "some-ds",
+					Network:         "some-network",
+					SubnetCIDR:      "10.0.0.0/24",
+				},
+			}
+		})
+
+		It("gets ye vsphere flags, omitting optional ones", func() {
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-user", concourse.StringArg("some-user")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-password", concourse.StringArg("some-password")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-ip", concourse.StringArg("10.0.0.5")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-dc", concourse.StringArg("some-dc")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-cluster", concourse.StringArg("some-cluster")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-rp", concourse.StringArg("some-rp")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-vcenter-ds", concourse.StringArg("some-ds")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-network", concourse.StringArg("some-network")))
+			Expect(flags).To(HaveKeyWithValue("vsphere-subnet-cidr", concourse.StringArg("10.0.0.0/24")))
+			Expect(flags).NotTo(HaveKey("vsphere-vcenter-disks"))
+		})
+
+		It("names the missing field", func() {
+			source.VSphere.SubnetCIDR = ""
+			_, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).To(MatchError("missing required source fields for iaas vsphere: vsphere.subnet_cidr"))
+		})
+	})
+
+	Context("when the iaas is openstack", func() {
+		It("gets ye openstack flags", func() {
+			source = concourse.Source{
+				IAAS: "openstack",
+				OpenStack: &concourse.OpenStack{
+					AuthURL:     "https://keystone.example.com",
+					AZ:          "some-az",
+					NetworkID:   "some-network-id",
+					NetworkName: "some-network-name",
+					Username:    "some-username",
+					Password:    "some-password",
+					Project:     "some-project",
+					Domain:      "some-domain",
+					Insecure:    true,
+				},
+			}
+			flags, err := outrunner.AppendSourceFlags(yeOldeFlags, source)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flags).To(HaveKeyWithValue("openstack-auth-url", concourse.StringArg("https://keystone.example.com")))
+			Expect(flags).To(HaveKeyWithValue("openstack-az", concourse.StringArg("some-az")))
+			Expect(flags).To(HaveKeyWithValue("openstack-network-id", concourse.StringArg("some-network-id")))
+			Expect(flags).To(HaveKeyWithValue("openstack-network-name", concourse.StringArg("some-network-name")))
+			Expect(flags).To(HaveKeyWithValue("openstack-username", concourse.StringArg("some-username")))
+			Expect(flags).To(HaveKeyWithValue("openstack-password", concourse.StringArg("some-password")))
+			Expect(flags).To(HaveKeyWithValue("openstack-project", concourse.StringArg("some-project")))
+			Expect(flags).To(HaveKeyWithValue("openstack-domain", concourse.StringArg("some-domain")))
+			Expect(flags).To(HaveKeyWithValue("openstack-insecure", concourse.BoolArg(true)))
+			Expect(flags).NotTo(HaveKey("openstack-region"))
+		})
+	})
+
+	Context("when the iaas is missing or unsupported", func() {
+		It("errors", func() {
+			_, err := outrunner.AppendSourceFlags(yeOldeFlags, concourse.Source{})
+			Expect(err).To(MatchError("missing required source field: iaas"))
+
+			_, err = outrunner.AppendSourceFlags(yeOldeFlags, concourse.Source{IAAS: "mainframe"})
+			Expect(err).To(MatchError(`unsupported iaas "mainframe"`))
+		})
+	})
 })
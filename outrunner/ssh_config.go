@@ -0,0 +1,76 @@
+package outrunner
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	SSHConfigFile  = "ssh_config"
+	KnownHostsFile = "known_hosts"
+
+	jumpboxUser = "jumpbox"
+)
+
+// an ssh client config for the jumpbox, for sshing to it or tunneling through it
+type SSHConfig struct {
+	JumpboxURL    string
+	JumpboxSSHKey string
+
+	// the jumpbox's public host key, when bbl's vars store has one
+	HostKey string
+}
+
+func NewSSHConfig(state BblState, jumpboxSSHKey, hostKey string) SSHConfig {
+	return SSHConfig{
+		JumpboxURL:    state.Jumpbox.URL,
+		JumpboxSSHKey: jumpboxSSHKey,
+		HostKey:       hostKey,
+	}
+}
+
+func (c SSHConfig) hostAndPort() (string, string) {
+	host, port, err := net.SplitHostPort(c.JumpboxURL)
+	if err != nil {
+		return c.JumpboxURL, "22"
+	}
+	return host, port
+}
+
+// paths are relative, so ssh has to be run from the state dir
+func (c SSHConfig) Config() string {
+	host, port := c.hostAndPort()
+
+	var b strings.Builder
+	b.WriteString("# generated by bbl-state-resource, use it from the state dir: ssh -F ssh_config jumpbox\n")
+	b.WriteString("Host jumpbox\n")
+	fmt.Fprintf(&b, "  HostName %s\n", host)
+	fmt.Fprintf(&b, "  Port %s\n", port)
+	fmt.Fprintf(&b, "  User %s\n", jumpboxUser)
+	fmt.Fprintf(&b, "  IdentityFile %s\n", JumpboxPrivateKeyFile)
+	b.WriteString("  IdentitiesOnly yes\n")
+	if c.HostKey != "" {
+		fmt.Fprintf(&b, "  UserKnownHostsFile %s\n", KnownHostsFile)
+		b.WriteString("  StrictHostKeyChecking yes\n")
+	} else {
+		// nothing to check it against, and the jumpbox is recreated often
+		b.WriteString("  UserKnownHostsFile /dev/null\n")
+		b.WriteString("  StrictHostKeyChecking no\n")
+	}
+	b.WriteString("  ServerAliveInterval 30\n")
+	return b.String()
+}
+
+// empty without a host key
+func (c SSHConfig) KnownHosts() string {
+	if c.HostKey == "" {
+		return ""
+	}
+
+	host, port := c.hostAndPort()
+	if port != "22" {
+		host = fmt.Sprintf("[%s]:%s", host, port)
+	}
+	return fmt.Sprintf("%s %s\n", host, strings.TrimSpace(c.HostKey))
+}
@@ -0,0 +1,57 @@
+package outrunner_test
+
+import (
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SSHConfig", func() {
+	var config outrunner.SSHConfig
+
+	BeforeEach(func() {
+		var state outrunner.BblState
+		state.Jumpbox.URL = "35.1.2.3:22"
+
+		config = outrunner.NewSSHConfig(state, "some-ssh-key", "ssh-rsa some-host-key\n")
+	})
+
+	It("checks the jumpbox's host key against known_hosts", func() {
+		Expect(config.Config()).To(Equal(`# generated by bbl-state-resource, use it from the state dir: ssh -F ssh_config jumpbox
+Host jumpbox
+  HostName 35.1.2.3
+  Port 22
+  User jumpbox
+  IdentityFile jumpbox-private.key
+  IdentitiesOnly yes
+  UserKnownHostsFile known_hosts
+  StrictHostKeyChecking yes
+  ServerAliveInterval 30
+`))
+		Expect(config.KnownHosts()).To(Equal("35.1.2.3 ssh-rsa some-host-key\n"))
+	})
+
+	It("brackets a non-standard port in known_hosts", func() {
+		config.JumpboxURL = "35.1.2.3:2222"
+
+		Expect(config.Config()).To(ContainSubstring("  Port 2222\n"))
+		Expect(config.KnownHosts()).To(Equal("[35.1.2.3]:2222 ssh-rsa some-host-key\n"))
+	})
+
+	It("defaults to port 22 when the url has none", func() {
+		config.JumpboxURL = "35.1.2.3"
+
+		Expect(config.Config()).To(ContainSubstring("  HostName 35.1.2.3\n  Port 22\n"))
+	})
+
+	Context("without a host key", func() {
+		BeforeEach(func() {
+			config.HostKey = ""
+		})
+
+		It("doesn't check the host key", func() {
+			Expect(config.Config()).To(ContainSubstring("  UserKnownHostsFile /dev/null\n  StrictHostKeyChecking no\n"))
+			Expect(config.KnownHosts()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package outrunner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	TerraformOutputsFile = "terraform-outputs.json"
+	TerraformVarsFile    = "vars.yml"
+)
+
+// what `bbl outputs` shows, minus the outputs terraform marks sensitive
+type TerraformOutputs map[string]interface{}
+
+type terraformOutput struct {
+	Value     interface{} `json:"value"`
+	Sensitive bool        `json:"sensitive"`
+}
+
+// terraform 0.11 and earlier write version 3 states, with outputs per module.
+// later ones write version 4, with the root module's outputs at the top.
+type terraformState struct {
+	Version int                        `json:"version"`
+	Outputs map[string]terraformOutput `json:"outputs"`
+	Modules []struct {
+		Path    []string                   `json:"path"`
+		Outputs map[string]terraformOutput `json:"outputs"`
+	} `json:"modules"`
+}
+
+// empty for an empty state, e.g. before bbl up has run terraform
+func ParseTerraformOutputs(tfState []byte) (TerraformOutputs, error) {
+	outputs := TerraformOutputs{}
+	if len(tfState) == 0 {
+		return outputs, nil
+	}
+
+	var state terraformState
+	err := json.Unmarshal(tfState, &state)
+	if err != nil {
+		return nil, fmt.Errorf("parsing terraform state: %s", err)
+	}
+
+	var raw map[string]terraformOutput
+	switch state.Version {
+	case 3:
+		for _, module := range state.Modules {
+			if len(module.Path) == 1 && module.Path[0] == "root" {
+				raw = module.Outputs
+			}
+		}
+	case 4:
+		raw = state.Outputs
+	default:
+		return nil, fmt.Errorf("unsupported terraform state version %d", state.Version)
+	}
+
+	for name, output := range raw {
+		if !output.Sensitive {
+			outputs[name] = output.Value
+		}
+	}
+	return outputs, nil
+}
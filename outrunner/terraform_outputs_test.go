@@ -0,0 +1,81 @@
+package outrunner_test
+
+import (
+	"github.com/cloudfoundry/bbl-state-resource/outrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const sampleTerraformStateV4 = `{
+	"version": 4,
+	"terraform_version": "0.12.31",
+	"outputs": {
+		"network_name": {"value": "some-env-network", "type": "string"},
+		"internal_cidr": {"value": "10.0.0.0/16", "type": "string"},
+		"cf_router_lb_target_pools": {"value": ["pool-a", "pool-b"], "type": ["list", "string"]},
+		"system_domain_dns_servers": {"value": ["ns1.example.com."], "type": ["list", "string"]},
+		"director_ssl_key": {"value": "some-key", "type": "string", "sensitive": true}
+	},
+	"resources": []
+}`
+
+const sampleTerraformStateV3 = `{
+	"version": 3,
+	"terraform_version": "0.11.14",
+	"modules": [
+		{
+			"path": ["root"],
+			"outputs": {
+				"network_name": {"sensitive": false, "type": "string", "value": "some-env-network"},
+				"director_ssl_key": {"sensitive": true, "type": "string", "value": "some-key"}
+			},
+			"resources": {}
+		},
+		{
+			"path": ["root", "some-module"],
+			"outputs": {
+				"module_only": {"sensitive": false, "type": "string", "value": "nope"}
+			},
+			"resources": {}
+		}
+	]
+}`
+
+var _ = Describe("ParseTerraformOutputs", func() {
+	It("reads the outputs of a version 4 state, without the sensitive ones", func() {
+		outputs, err := outrunner.ParseTerraformOutputs([]byte(sampleTerraformStateV4))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(outputs).To(Equal(outrunner.TerraformOutputs{
+			"network_name":              "some-env-network",
+			"internal_cidr":             "10.0.0.0/16",
+			"cf_router_lb_target_pools": []interface{}{"pool-a", "pool-b"},
+			"system_domain_dns_servers": []interface{}{"ns1.example.com."},
+		}))
+	})
+
+	It("reads the root module's outputs of a version 3 state, without the sensitive ones", func() {
+		outputs, err := outrunner.ParseTerraformOutputs([]byte(sampleTerraformStateV3))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(outputs).To(Equal(outrunner.TerraformOutputs{
+			"network_name": "some-env-network",
+		}))
+	})
+
+	It("has no outputs without a state", func() {
+		outputs, err := outrunner.ParseTerraformOutputs(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outputs).To(BeEmpty())
+	})
+
+	It("errors on state versions it doesn't know", func() {
+		_, err := outrunner.ParseTerraformOutputs([]byte(`{"version": 5}`))
+		Expect(err).To(MatchError("unsupported terraform state version 5"))
+	})
+
+	It("errors on a malformed state", func() {
+		_, err := outrunner.ParseTerraformOutputs([]byte(`{`))
+		Expect(err).To(MatchError(ContainSubstring("parsing terraform state")))
+	})
+})
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobs are shared between every environment in the bucket,
+// so they live under a prefix that can never collide with an env name
+const blobPrefix = "blobs/sha256/"
+
+const manifestFormat = "bbl-state-resource/content-addressed/v1"
+
+type manifest struct {
+	Format  string          `json:"format"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Path     string      `json:"path"`
+	Mode     os.FileMode `json:"mode"`
+	Digest   string      `json:"digest,omitempty"`
+	Linkname string      `json:"linkname,omitempty"`
+}
+
+func blobName(digest string) string {
+	return blobPrefix + digest
+}
+
+// uploads every file not already in the bucket as a gzipped blob,
+// then replaces the object with a manifest pointing at those blobs
+func (s Storage) uploadContentAddressed(ctx context.Context, dir string, metadata map[string]string) (Version, error) {
+	m := manifest{Format: manifestFormat}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		entry := manifestEntry{Path: filepath.ToSlash(rel), Mode: info.Mode()}
+		switch {
+		case info.IsDir():
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Linkname, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			entry.Digest, err = s.putBlob(ctx, path)
+			if err != nil {
+				return fmt.Errorf("%s: uploading blob: %s", rel, err)
+			}
+		default:
+			return nil // sockets and devices have no business in a state dir
+		}
+		m.Entries = append(m.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return Version{}, err
+	}
+
+	writer := s.Object.NewWriter(ctx, metadata)
+	err = json.NewEncoder(writer).Encode(m)
+	if err != nil {
+		return Version{}, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return Version{}, err
+	}
+
+	return s.Version(ctx)
+}
+
+// the file is snapshotted before it's hashed, so the blob always holds
+// exactly the bytes its name is the digest of, even if the file is being
+// rewritten underneath us (e.g. terraform during a checkpoint)
+func (s Storage) putBlob(ctx context.Context, path string) (string, error) {
+	snapshot, digest, err := snapshotFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(snapshot.Name())
+	defer snapshot.Close()
+
+	blob := s.Bucket.Object(blobName(digest))
+	_, err = blob.Version(ctx)
+	if err == nil {
+		return digest, nil // unchanged since some previous upload
+	}
+	if err != ObjectNotFoundError {
+		return "", err
+	}
+
+	writer := blob.NewWriter(ctx, nil)
+	gz := gzip.NewWriter(writer)
+	_, err = io.Copy(gz, snapshot)
+	if err != nil {
+		return "", err
+	}
+	err = gz.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return digest, writer.Close()
+}
+
+// copies path to a temp file, rewound and ready to read, along with the digest of what was copied
+func snapshotFile(path string) (*os.File, string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer in.Close()
+
+	snapshot, err := ioutil.TempFile("", "bbl-state-blob")
+	if err != nil {
+		return nil, "", err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(snapshot, io.TeeReader(in, h))
+	if err == nil {
+		_, err = snapshot.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		snapshot.Close()
+		os.Remove(snapshot.Name())
+		return nil, "", err
+	}
+	return snapshot, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s Storage) downloadContentAddressed(ctx context.Context, reader io.Reader, targetDir string, opts DownloadOptions) error {
+	var m manifest
+	err := json.NewDecoder(reader).Decode(&m)
+	if err != nil {
+		return fmt.Errorf("decoding state manifest: %s", err)
+	}
+	if m.Format != manifestFormat {
+		return fmt.Errorf("unsupported state manifest format %q", m.Format)
+	}
+
+	for _, entry := range m.Entries {
+		if !opts.selects(entry.Path) {
+			continue
+		}
+
+		fpath := filepath.Join(targetDir, filepath.FromSlash(entry.Path))
+		if !strings.HasPrefix(fpath, filepath.Clean(targetDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("%s: path escapes the state dir", entry.Path)
+		}
+
+		switch {
+		case entry.Mode.IsDir():
+			if err := os.MkdirAll(fpath, entry.Mode.Perm()); err != nil {
+				return fmt.Errorf("failed to make directory %s: %w", fpath, err)
+			}
+		case entry.Mode&os.ModeSymlink != 0:
+			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+				return fmt.Errorf("failed to make directory %s: %w", filepath.Dir(fpath), err)
+			}
+			if err := os.Symlink(entry.Linkname, fpath); err != nil {
+				return fmt.Errorf("%s: making symbolic link for: %v", fpath, err)
+			}
+		default:
+			if err := s.getBlob(ctx, entry, fpath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s Storage) getBlob(ctx context.Context, entry manifestEntry, fpath string) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return fmt.Errorf("failed to make directory %s: %w", filepath.Dir(fpath), err)
+	}
+
+	reader, err := s.Bucket.Object(blobName(entry.Digest)).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: reading blob %s: %s", entry.Path, entry.Digest, err)
+	}
+	defer reader.Close()
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return fmt.Errorf("%s: reading blob %s: %s", entry.Path, entry.Digest, err)
+	}
+	defer gz.Close()
+
+	out, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return fmt.Errorf("%s: creating new file: %v", fpath, err)
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), gz)
+	if err != nil {
+		return fmt.Errorf("%s: writing file: %v", fpath, err)
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); digest != entry.Digest {
+		out.Close()
+		os.Remove(fpath)
+		return fmt.Errorf("%s: blob %s is corrupt, its contents have digest %s", entry.Path, entry.Digest, digest)
+	}
+	return out.Close()
+}
+
+// lets a content-addressed storage still read versions
+// that were uploaded as tarballs before the layout was enabled
+func isManifest(r *bufio.Reader) bool {
+	head, err := r.Peek(1)
+	return err == nil && head[0] == '{'
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// an Object kept on the local filesystem, e.g. on a mounted volume.
+// its metadata is kept alongside it, in <path>.metadata.json
+type fileObject struct {
+	path string
+}
+
+func (f fileObject) metadataPath() string {
+	return f.path + ".metadata.json"
+}
+
+func (f fileObject) metadata() (map[string]string, error) {
+	contents, err := ioutil.ReadFile(f.metadataPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var metadata map[string]string
+	err = json.Unmarshal(contents, &metadata)
+	return metadata, err
+}
+
+func (f fileObject) Version(ctx context.Context) (Version, error) {
+	in, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return Version{}, ObjectNotFoundError
+	}
+	if err != nil {
+		return Version{}, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return Version{}, err
+	}
+
+	h := md5.New()
+	_, err = io.Copy(h, in)
+	if err != nil {
+		return Version{}, err
+	}
+
+	metadata, err := f.metadata()
+	if err != nil {
+		return Version{}, err
+	}
+
+	return Version{Name: filepath.Base(f.path), Ref: hex.EncodeToString(h.Sum(nil)), Updated: info.ModTime(), Metadata: metadata}, nil
+}
+
+func (f fileObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	r, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil, ObjectNotFoundError
+	}
+	return r, err
+}
+
+func (f fileObject) NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser {
+	return &fileWriter{path: f.path, metadataPath: f.metadataPath(), metadata: metadata}
+}
+
+func (f fileObject) Delete(ctx context.Context) error {
+	err := os.Remove(f.path)
+	if os.IsNotExist(err) {
+		return ObjectNotFoundError
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(f.metadataPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// writes to a temp file alongside path and renames it into place on Close,
+// so a half-written file never replaces a good one. the metadata goes in first,
+// so the file is never there without it
+type fileWriter struct {
+	path         string
+	metadataPath string
+	metadata     map[string]string
+	tmp          *os.File
+	err          error
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.tmp == nil && w.err == nil {
+		w.err = os.MkdirAll(filepath.Dir(w.path), 0700)
+		if w.err == nil {
+			w.tmp, w.err = ioutil.TempFile(filepath.Dir(w.path), filepath.Base(w.path))
+		}
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.tmp.Write(p)
+}
+
+func (w *fileWriter) Close() error {
+	if w.tmp == nil && w.err == nil {
+		_, w.err = w.Write(nil)
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	err := w.tmp.Close()
+	if err == nil {
+		err = w.writeMetadata()
+	}
+	if err != nil {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+	return os.Rename(w.tmp.Name(), w.path)
+}
+
+func (w *fileWriter) writeMetadata() error {
+	if len(w.metadata) == 0 {
+		err := os.Remove(w.metadataPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	contents, err := json.Marshal(w.metadata)
+	if err != nil {
+		return err
+	}
+	tmp := w.metadataPath + ".tmp"
+	err = ioutil.WriteFile(tmp, contents, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.metadataPath)
+}
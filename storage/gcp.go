@@ -14,13 +14,18 @@ import (
 	"google.golang.org/api/option"
 )
 
+var tarball = archiver.CompressedArchive{
+	Compression: archiver.Gz{},
+	Archival:    archiver.Tar{},
+}
+
 // untested gcs api instantiation
 type objectHandleWrapper struct {
 	objectHandle *gcs.ObjectHandle
 }
 
-func (o objectHandleWrapper) Version() (Version, error) {
-	r, err := o.objectHandle.Attrs(context.Background())
+func (o objectHandleWrapper) Version(ctx context.Context) (Version, error) {
+	r, err := o.objectHandle.Attrs(ctx)
 	if err == gcs.ErrObjectNotExist {
 		return Version{}, ObjectNotFoundError
 	}
@@ -28,27 +33,51 @@ func (o objectHandleWrapper) Version() (Version, error) {
 		return Version{}, err
 	}
 
-	return Version{Name: r.Name, Ref: hex.EncodeToString(r.MD5), Updated: r.Updated}, nil
+	return Version{Name: r.Name, Ref: hex.EncodeToString(r.MD5), Updated: r.Updated, Metadata: r.Metadata}, nil
 }
 
-func (o objectHandleWrapper) NewReader() (io.ReadCloser, error) {
-	r, err := o.objectHandle.NewReader(context.Background())
+func (o objectHandleWrapper) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	r, err := o.objectHandle.NewReader(ctx)
 	if err == gcs.ErrObjectNotExist {
 		return nil, ObjectNotFoundError
 	}
 	return r, err
 }
 
-func (o objectHandleWrapper) NewWriter() io.WriteCloser {
-	return o.objectHandle.NewWriter(context.Background())
+func (o objectHandleWrapper) NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser {
+	w := o.objectHandle.NewWriter(ctx)
+	w.Metadata = metadata
+	return w
+}
+
+func (o objectHandleWrapper) Delete(ctx context.Context) error {
+	err := o.objectHandle.Delete(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return ObjectNotFoundError
+	}
+	return err
 }
 
 type bucketHandleWrapper struct {
 	bucketHandle *gcs.BucketHandle
 }
 
-func (b bucketHandleWrapper) GetAllObjects() ([]Object, error) {
-	objectIter := b.bucketHandle.Objects(context.Background(), nil)
+func (b bucketHandleWrapper) Object(name string) Object {
+	return objectHandleWrapper{objectHandle: b.bucketHandle.Object(name)}
+}
+
+// the delimiter keeps gcs from listing anything nested under a "/",
+// like blobs and records, which only grow
+func (b bucketHandleWrapper) GetAllObjects(ctx context.Context) ([]Object, error) {
+	return b.listObjects(ctx, &gcs.Query{Delimiter: "/"})
+}
+
+func (b bucketHandleWrapper) GetObjectsWithPrefix(ctx context.Context, prefix string) ([]Object, error) {
+	return b.listObjects(ctx, &gcs.Query{Prefix: prefix})
+}
+
+func (b bucketHandleWrapper) listObjects(ctx context.Context, query *gcs.Query) ([]Object, error) {
+	objectIter := b.bucketHandle.Objects(ctx, query)
 
 	var objects []Object
 	for {
@@ -59,14 +88,17 @@ func (b bucketHandleWrapper) GetAllObjects() ([]Object, error) {
 		if err != nil {
 			return nil, err
 		}
+		if next.Prefix != "" {
+			continue // a "directory" the delimiter collapsed, not an object
+		}
 		handle := objectHandleWrapper{objectHandle: b.bucketHandle.Object(next.Name)}
 		objects = append(objects, handle)
 	}
 	return objects, nil
 }
 
-func (b bucketHandleWrapper) Delete() error {
-	objectIter := b.bucketHandle.Objects(context.Background(), nil)
+func (b bucketHandleWrapper) Delete(ctx context.Context) error {
+	objectIter := b.bucketHandle.Objects(ctx, nil)
 
 	for {
 		next, err := objectIter.Next()
@@ -76,23 +108,27 @@ func (b bucketHandleWrapper) Delete() error {
 		if err != nil {
 			return err
 		}
-		err = b.bucketHandle.Object(next.Name).Delete(context.Background())
+		err = b.bucketHandle.Object(next.Name).Delete(ctx)
 		if err != nil {
 			return err
 		}
 	}
-	return b.bucketHandle.Delete(context.Background())
+	return b.bucketHandle.Delete(ctx)
 }
 
-func NewGCSStorage(serviceAccountKey, objectName, bucketName string) (Storage, error) {
-	storageJwtConf, err := oauthgoogle.JWTConfigFromJSON([]byte(serviceAccountKey), gcs.ScopeReadWrite)
+func NewGCSStorage(ctx context.Context, serviceAccountKey, objectName, bucketName string, opts Options) (Storage, error) {
+	scope := gcs.ScopeReadWrite
+	if opts.ReadOnly {
+		scope = gcs.ScopeReadOnly // so gcs enforces it too
+	}
+	storageJwtConf, err := oauthgoogle.JWTConfigFromJSON([]byte(serviceAccountKey), scope)
 	if err != nil {
 		return Storage{}, fmt.Errorf("failed to form JWT config from GCP storage account key: %s", err)
 	}
-	ctx := context.Background()
-	tokenSource := storageJwtConf.TokenSource(ctx)
+	// the client outlives any one operation, so it must not inherit ctx's deadline
+	tokenSource := storageJwtConf.TokenSource(context.Background())
 
-	storageClient, err := gcs.NewClient(ctx, option.WithTokenSource(tokenSource))
+	storageClient, err := gcs.NewClient(context.Background(), option.WithTokenSource(tokenSource))
 	if err != nil {
 		return Storage{}, fmt.Errorf("failed to instantiate storageclient: %s", err)
 	}
@@ -104,30 +140,38 @@ func NewGCSStorage(serviceAccountKey, objectName, bucketName string) (Storage, e
 		return Storage{}, fmt.Errorf("Unmarshalling account key for project id: %s", err)
 	}
 	bucket := storageClient.Bucket(bucketName).UserProject(p.ProjectId)
-
-	_, err = bucket.Attrs(ctx)
-	if err != nil && err != gcs.ErrBucketNotExist {
+	retry := opts.Retry.WithDefaults()
+
+	err = retry.do(ctx, func(ctx context.Context) error {
+		_, err := bucket.Attrs(ctx)
+		return err
+	})
+	if err == gcs.ErrBucketNotExist {
+		if !opts.CreateBucket || opts.ReadOnly {
+			return Storage{}, BucketNotFoundError
+		}
+		err = retry.do(ctx, func(ctx context.Context) error {
+			return bucket.Create(ctx, p.ProjectId, nil)
+		})
+		if err != nil {
+			return Storage{}, fmt.Errorf("Failed to create bucket: %s", err)
+		}
+	} else if err != nil {
 		return Storage{}, fmt.Errorf("Failed to get bucket: %s", err)
-	} else if err == gcs.ErrBucketNotExist {
-		err = bucket.Create(ctx, p.ProjectId, nil)
-	}
-	if err != nil {
-		return Storage{}, fmt.Errorf("Failed to create bucket: %s", err)
 	}
 
 	object := bucket.Object(objectName)
 
 	return Storage{
 		Name: objectName,
-		Bucket: bucketHandleWrapper{
+		Bucket: retry.Bucket(bucketHandleWrapper{
 			bucketHandle: bucket,
-		},
-		Object: objectHandleWrapper{
+		}),
+		Object: retry.Object(objectHandleWrapper{
 			objectHandle: object,
-		},
-		Archiver: archiver.CompressedArchive{
-			Compression: archiver.Gz{},
-			Archival:    archiver.Tar{},
-		},
+		}),
+		Archiver:         tarball,
+		ContentAddressed: opts.ContentAddressed,
+		ReadOnly:         opts.ReadOnly,
 	}, nil
 }
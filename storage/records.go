@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// records are small documents kept alongside an environment's state,
+// under <name>/<kind>/, e.g. the audit log of its puts
+
+const recordTimeFormat = "20060102T150405.000000000Z"
+
+// only the state objects themselves are environments,
+// anything nested under a prefix is a blob or a record
+func isEnvironment(name string) bool {
+	return !strings.Contains(name, "/")
+}
+
+func (s Storage) recordPrefix(kind string) string {
+	return fmt.Sprintf("%s/%s/", s.Name, kind)
+}
+
+// names sort by when they were written, the suffix keeps concurrent puts from clobbering each other
+func (s Storage) WriteRecord(ctx context.Context, kind string, contents []byte) error {
+	if s.ReadOnly {
+		return ReadOnlyError
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s%s-%x.json", s.recordPrefix(kind), time.Now().UTC().Format(recordTimeFormat), suffix)
+
+	w := s.Bucket.Object(name).NewWriter(ctx, nil)
+	_, err := w.Write(contents)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// oldest first
+func (s Storage) ReadRecords(ctx context.Context, kind string) ([][]byte, error) {
+	objects, err := s.Bucket.GetObjectsWithPrefix(ctx, s.recordPrefix(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	type record struct {
+		name     string
+		contents []byte
+	}
+	var records []record
+	for _, object := range objects {
+		version, err := object.Version(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := object.NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record{name: version.Name, contents: contents})
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].name < records[j].name })
+	result := make([][]byte, len(records))
+	for i, r := range records {
+		result[i] = r.contents
+	}
+	return result, nil
+}
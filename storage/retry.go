@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// fraction of each backoff that is randomized, up to 1
+	Jitter float64
+	// bounds each attempt, zero means only the caller's context applies
+	OperationTimeout time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// fills in any unset fields from DefaultRetryPolicy
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Jitter <= 0 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff << uint(attempt)
+	if backoff > p.MaxBackoff || backoff <= 0 {
+		backoff = p.MaxBackoff
+	}
+	jitter := time.Duration(p.Jitter * float64(backoff) * (rand.Float64()*2 - 1))
+	return backoff + jitter
+}
+
+func (p RetryPolicy) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.OperationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.OperationTimeout)
+}
+
+func (p RetryPolicy) do(ctx context.Context, f func(context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < p.Attempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(p.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		attemptCtx, cancel := p.attemptContext(ctx)
+		err = f(attemptCtx)
+		cancel()
+
+		if ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	if err == nil || err == ObjectNotFoundError {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+
+	// the caller's context is checked separately,
+	// so this can only be an attempt that ran out of time
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// wraps a Bucket and every Object it hands out with p
+func (p RetryPolicy) Bucket(bucket Bucket) Bucket {
+	return retryingBucket{bucket: bucket, policy: p}
+}
+
+func (p RetryPolicy) Object(object Object) Object {
+	return retryingObject{object: object, policy: p}
+}
+
+type retryingBucket struct {
+	bucket Bucket
+	policy RetryPolicy
+}
+
+func (b retryingBucket) Object(name string) Object {
+	return b.policy.Object(b.bucket.Object(name))
+}
+
+func (b retryingBucket) GetAllObjects(ctx context.Context) ([]Object, error) {
+	return b.listObjects(ctx, b.bucket.GetAllObjects)
+}
+
+func (b retryingBucket) GetObjectsWithPrefix(ctx context.Context, prefix string) ([]Object, error) {
+	return b.listObjects(ctx, func(ctx context.Context) ([]Object, error) {
+		return b.bucket.GetObjectsWithPrefix(ctx, prefix)
+	})
+}
+
+func (b retryingBucket) listObjects(ctx context.Context, list func(ctx context.Context) ([]Object, error)) ([]Object, error) {
+	var objects []Object
+	err := b.policy.do(ctx, func(ctx context.Context) error {
+		var err error
+		objects, err = list(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := make([]Object, len(objects))
+	for i, object := range objects {
+		wrapped[i] = b.policy.Object(object)
+	}
+	return wrapped, nil
+}
+
+func (b retryingBucket) Delete(ctx context.Context) error {
+	return b.policy.do(ctx, b.bucket.Delete)
+}
+
+type retryingObject struct {
+	object Object
+	policy RetryPolicy
+}
+
+func (o retryingObject) Version(ctx context.Context) (Version, error) {
+	var version Version
+	err := o.policy.do(ctx, func(ctx context.Context) error {
+		var err error
+		version, err = o.object.Version(ctx)
+		return err
+	})
+	return version, err
+}
+
+// only opening the reader is retried. the operation timeout
+// keeps running while it's read, until it's closed.
+func (o retryingObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	var err error
+	for attempt := 0; attempt < o.policy.Attempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(o.policy.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, err
+			case <-timer.C:
+			}
+		}
+
+		attemptCtx, cancel := o.policy.attemptContext(ctx)
+		reader, err = o.object.NewReader(attemptCtx)
+		if err == nil {
+			return cancelingReader{ReadCloser: reader, cancel: cancel}, nil
+		}
+		cancel()
+
+		if ctx.Err() != nil || !isRetryable(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+type cancelingReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r cancelingReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+func (o retryingObject) Delete(ctx context.Context) error {
+	return o.policy.do(ctx, o.object.Delete)
+}
+
+// buffers everything written so the whole upload can be replayed
+// if the underlying writer fails on Close
+func (o retryingObject) NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser {
+	return &retryingWriter{ctx: ctx, metadata: metadata, object: o.object, policy: o.policy}
+}
+
+type retryingWriter struct {
+	bytes.Buffer
+	ctx      context.Context
+	metadata map[string]string
+	object   Object
+	policy   RetryPolicy
+}
+
+func (w *retryingWriter) Close() error {
+	return w.policy.do(w.ctx, func(ctx context.Context) error {
+		writer := w.object.NewWriter(ctx, w.metadata)
+		_, err := io.Copy(writer, bytes.NewReader(w.Bytes()))
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		return writer.Close()
+	})
+}
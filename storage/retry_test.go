@@ -0,0 +1,167 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudfoundry/bbl-state-resource/fakes"
+	"github.com/cloudfoundry/bbl-state-resource/storage"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/googleapi"
+)
+
+var _ = Describe("RetryPolicy", func() {
+	var (
+		policy     storage.RetryPolicy
+		fakeObject *fakes.Object
+		fakeBucket *fakes.Bucket
+	)
+
+	BeforeEach(func() {
+		policy = storage.RetryPolicy{
+			Attempts:       3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+			Jitter:         0.5,
+		}
+		fakeObject = &fakes.Object{}
+		fakeBucket = &fakes.Bucket{}
+	})
+
+	Describe("WithDefaults", func() {
+		It("fills in every field of the zero-value policy", func() {
+			Expect(storage.RetryPolicy{}.WithDefaults()).To(Equal(storage.DefaultRetryPolicy))
+		})
+
+		It("keeps the fields that are set, capping jitter at 1", func() {
+			Expect(policy.WithDefaults()).To(Equal(policy))
+
+			policy.Jitter = 3
+			Expect(policy.WithDefaults().Jitter).To(Equal(1.0))
+		})
+	})
+
+	Context("when the error is transient", func() {
+		BeforeEach(func() {
+			fakeObject.VersionCall.Returns.Error = &googleapi.Error{Code: 503}
+			fakeBucket.ObjectsCall.Returns.Error = &googleapi.Error{Code: 429}
+		})
+
+		It("retries object calls until it runs out of attempts", func() {
+			_, err := policy.Object(fakeObject).Version(ctx)
+			Expect(err).To(MatchError(ContainSubstring("503")))
+			Expect(fakeObject.VersionCall.CallCount).To(Equal(3))
+		})
+
+		It("retries bucket calls until it runs out of attempts", func() {
+			_, err := policy.Bucket(fakeBucket).GetAllObjects(ctx)
+			Expect(err).To(MatchError(ContainSubstring("429")))
+			Expect(fakeBucket.ObjectsCall.CallCount).To(Equal(3))
+		})
+	})
+
+	Context("when the error is not transient", func() {
+		BeforeEach(func() {
+			fakeObject.VersionCall.Returns.Error = errors.New("mangosteen")
+		})
+
+		It("gives up immediately", func() {
+			_, err := policy.Object(fakeObject).Version(ctx)
+			Expect(err).To(MatchError("mangosteen"))
+			Expect(fakeObject.VersionCall.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("when the object does not exist", func() {
+		BeforeEach(func() {
+			fakeObject.VersionCall.Returns.Error = storage.ObjectNotFoundError
+		})
+
+		It("does not retry", func() {
+			_, err := policy.Object(fakeObject).Version(ctx)
+			Expect(err).To(Equal(storage.ObjectNotFoundError))
+			Expect(fakeObject.VersionCall.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("when the caller's context is cancelled", func() {
+		BeforeEach(func() {
+			fakeObject.VersionCall.Returns.Error = &googleapi.Error{Code: 503}
+		})
+
+		It("stops retrying", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			_, err := policy.Object(fakeObject).Version(cancelled)
+			Expect(err).To(HaveOccurred())
+			Expect(fakeObject.VersionCall.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("with an operation timeout", func() {
+		BeforeEach(func() {
+			policy.OperationTimeout = time.Minute
+		})
+
+		It("gives each attempt a deadline", func() {
+			object := &deadlineObject{}
+			_, err := policy.Object(object).Version(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(object.deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+	})
+
+	Describe("NewWriter", func() {
+		var fakeWriteCloser *fakes.WriteCloser
+
+		BeforeEach(func() {
+			fakeWriteCloser = &fakes.WriteCloser{}
+			fakeWriteCloser.WriteCall.Returns.BytesWritten = len("lychee")
+			fakeObject.NewWriterCall.Returns.WriteCloser = fakeWriteCloser
+		})
+
+		It("replays the whole upload when closing fails transiently", func() {
+			fakeWriteCloser.CloseCall.Returns.Error = &googleapi.Error{Code: 503}
+
+			writer := policy.Object(fakeObject).NewWriter(ctx, nil)
+			_, err := writer.Write([]byte("lychee"))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = writer.Close()
+			Expect(err).To(HaveOccurred())
+			Expect(fakeObject.NewWriterCall.CallCount).To(Equal(3))
+			Expect(fakeWriteCloser.CloseCall.CallCount).To(Equal(3))
+			Expect(string(fakeWriteCloser.WriteCall.Receives.Contents)).To(Equal("lychee"))
+		})
+
+		It("uploads once when nothing goes wrong", func() {
+			object := &fakes.MemoryObject{Name: "rambutan"}
+
+			writer := policy.Object(object).NewWriter(ctx, nil)
+			_, err := writer.Write([]byte("lychee"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			reader, err := object.NewReader(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := ioutil.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("lychee"))
+			Expect(object.WriteCount).To(Equal(1))
+		})
+	})
+})
+
+type deadlineObject struct {
+	fakes.Object
+	deadline time.Time
+}
+
+func (d *deadlineObject) Version(ctx context.Context) (storage.Version, error) {
+	d.deadline, _ = ctx.Deadline()
+	return storage.Version{}, nil
+}
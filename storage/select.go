@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// narrows down what Download does
+type DownloadOptions struct {
+	// globs of the paths in the state to extract, e.g. bbl-state.json or vars/.
+	// a pattern selects the paths it matches and everything under them.
+	// empty means everything
+	Files []string
+	// a missing object is an ObjectNotFoundError instead of being created empty
+	ReadOnly bool
+}
+
+func (o DownloadOptions) validate() error {
+	for _, pattern := range o.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid files pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// name is a slash separated path in the state
+func (o DownloadOptions) selects(name string) bool {
+	if len(o.Files) == 0 {
+		return true
+	}
+
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	for _, pattern := range o.Files {
+		pattern = path.Clean(pattern)
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
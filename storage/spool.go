@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// the metadata key a spooled state records the ref of the bucket's state
+// it was built on under, empty if the bucket had no state
+const SpoolBaseRefMetadataKey = "base-ref"
+
+var SpoolBaseRefUnknownError = errors.New("the spooled state doesn't record which bbl state it was built on")
+
+// Spool is a second place to park a state when it can't be uploaded to the bucket,
+// so that it survives the put's container being garbage collected
+type Spool struct {
+	// human readable, for recovery instructions
+	Location string
+	storage  Storage
+}
+
+// spools to <dir>/<bucketName>/<objectName>.tgz, e.g. on a mounted volume
+func NewDirectorySpool(dir, bucketName, objectName string) Spool {
+	path := filepath.Join(dir, bucketName, objectName+".tgz")
+	object := fileObject{path: path}
+	return Spool{
+		Location: path,
+		storage: Storage{
+			Name:     objectName,
+			Object:   object,
+			Archiver: tarball,
+		},
+	}
+}
+
+// spools to an object of the same name in a secondary bucket
+func NewBucketSpool(ctx context.Context, serviceAccountKey, bucketName, objectName string, opts Options) (Spool, error) {
+	opts.ContentAddressed = false // spooled states are always plain tarballs
+	s, err := NewGCSStorage(ctx, serviceAccountKey, objectName, bucketName, opts)
+	if err != nil {
+		return Spool{}, err
+	}
+	return Spool{
+		Location: fmt.Sprintf("gs://%s/%s", bucketName, objectName),
+		storage:  s,
+	}, nil
+}
+
+// baseRef is the ref of the bucket's state the put started from, so the state
+// is only ever reconciled over the state it was built on
+func (s Spool) Save(ctx context.Context, filePath, baseRef string) error {
+	_, err := s.storage.UploadWithMetadata(ctx, filePath, map[string]string{SpoolBaseRefMetadataKey: baseRef})
+	return err
+}
+
+// reports whether there was a spooled state to restore into targetDir,
+// and the ref of the bucket's state it was built on
+func (s Spool) Restore(ctx context.Context, targetDir string) (string, bool, error) {
+	version, err := s.storage.Object.Version(ctx)
+	if err == ObjectNotFoundError {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	baseRef, ok := version.Metadata[SpoolBaseRefMetadataKey]
+	if !ok {
+		return "", false, SpoolBaseRefUnknownError
+	}
+
+	_, err = s.storage.Download(ctx, targetDir)
+	if err != nil {
+		return "", false, err
+	}
+	return baseRef, true, nil
+}
+
+func (s Spool) Discard(ctx context.Context) error {
+	err := s.storage.Object.Delete(ctx)
+	if err == ObjectNotFoundError {
+		return nil
+	}
+	return err
+}
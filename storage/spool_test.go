@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bbl-state-resource/storage"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Spool", func() {
+	var (
+		spoolDir  string
+		stateDir  string
+		targetDir string
+		spool     storage.Spool
+	)
+
+	BeforeEach(func() {
+		var err error
+		spoolDir, err = ioutil.TempDir("", "spool_dir")
+		Expect(err).NotTo(HaveOccurred())
+		stateDir, err = ioutil.TempDir("", "state_dir")
+		Expect(err).NotTo(HaveOccurred())
+		targetDir, err = ioutil.TempDir("", "target_dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.MkdirAll(filepath.Join(stateDir, "vars"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(stateDir, "vars", "terraform.tfstate"), []byte("jackfruit"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		spool = storage.NewDirectorySpool(spoolDir, "some-bucket", "some-env")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(spoolDir)
+		_ = os.RemoveAll(stateDir)
+		_ = os.RemoveAll(targetDir)
+	})
+
+	It("reports where it spools to", func() {
+		Expect(spool.Location).To(Equal(filepath.Join(spoolDir, "some-bucket", "some-env.tgz")))
+	})
+
+	Context("when nothing has been spooled", func() {
+		It("has nothing to restore", func() {
+			_, found, err := spool.Restore(ctx, targetDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("discards without error", func() {
+			Expect(spool.Discard(ctx)).To(Succeed())
+		})
+	})
+
+	Context("when a state has been spooled", func() {
+		BeforeEach(func() {
+			Expect(spool.Save(ctx, stateDir, "some-base-ref")).To(Succeed())
+		})
+
+		It("restores it, with the ref of the state it was built on", func() {
+			baseRef, found, err := spool.Restore(ctx, targetDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(baseRef).To(Equal("some-base-ref"))
+
+			contents, err := ioutil.ReadFile(filepath.Join(targetDir, "vars", "terraform.tfstate"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("jackfruit"))
+		})
+
+		It("keeps an empty base ref for a state built on nothing", func() {
+			Expect(spool.Save(ctx, stateDir, "")).To(Succeed())
+
+			baseRef, found, err := spool.Restore(ctx, targetDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(baseRef).To(BeEmpty())
+		})
+
+		It("forgets it once discarded", func() {
+			Expect(spool.Discard(ctx)).To(Succeed())
+
+			_, found, err := spool.Restore(ctx, targetDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			Expect(filepath.Join(spoolDir, "some-bucket", "some-env.tgz.metadata.json")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when a state was spooled without the ref it was built on", func() {
+		BeforeEach(func() {
+			Expect(spool.Save(ctx, stateDir, "some-base-ref")).To(Succeed())
+			Expect(os.Remove(filepath.Join(spoolDir, "some-bucket", "some-env.tgz.metadata.json"))).To(Succeed())
+		})
+
+		It("refuses to restore it", func() {
+			_, found, err := spool.Restore(ctx, targetDir)
+			Expect(err).To(Equal(storage.SpoolBaseRefUnknownError))
+			Expect(found).To(BeFalse())
+		})
+	})
+})
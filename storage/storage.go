@@ -2,6 +2,7 @@ package storage
 
 import (
 	"archive/tar"
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -15,23 +16,39 @@ import (
 )
 
 var ObjectNotFoundError = errors.New("Object not found")
+var BucketNotFoundError = errors.New("Bucket not found")
+var ReadOnlyError = errors.New("storage is read only")
 
 type Version struct {
 	Name    string    `json:"name"`
 	Ref     string    `json:"ref"`
 	Updated time.Time `json:"updated"`
+
+	// the object's custom metadata, never part of a concourse version
+	Metadata map[string]string `json:"-"`
 }
 
+// the status metadata key tells a checkpoint apart from the final state of a put
+const (
+	StatusMetadataKey = "status"
+	StatusInProgress  = "in-progress"
+	StatusComplete    = "complete"
+)
+
 // public only because []Object != []ObjectImpl :(
 type Object interface {
-	NewReader() (io.ReadCloser, error)
-	NewWriter() io.WriteCloser
-	Version() (Version, error)
+	NewReader(ctx context.Context) (io.ReadCloser, error)
+	NewWriter(ctx context.Context, metadata map[string]string) io.WriteCloser
+	Version(ctx context.Context) (Version, error)
+	Delete(ctx context.Context) error
 }
 
 type Bucket interface {
-	GetAllObjects() ([]Object, error)
-	Delete() error // test only
+	Object(name string) Object
+	// only the top-level objects, i.e. the environments, never anything under a "/"
+	GetAllObjects(ctx context.Context) ([]Object, error)
+	GetObjectsWithPrefix(ctx context.Context, prefix string) ([]Object, error)
+	Delete(ctx context.Context) error // test only
 }
 
 type tarrer interface {
@@ -44,19 +61,32 @@ type Storage struct {
 	Bucket   Bucket
 	Object   Object
 	Archiver tarrer
+
+	// store files as deduplicated blobs referenced by a manifest
+	// instead of uploading a fresh tarball for every version
+	ContentAddressed bool
+
+	// for check and get, which must never create anything
+	ReadOnly bool
 }
 
-func (s Storage) GetAllNewerVersions(watermark Version) ([]Version, error) {
-	objects, err := s.Bucket.GetAllObjects()
+func (s Storage) GetAllNewerVersions(ctx context.Context, watermark Version) ([]Version, error) {
+	objects, err := s.Bucket.GetAllObjects(ctx)
 	if err != nil {
 		return nil, err
 	}
 	versions := []Version{}
 	for _, object := range objects {
-		version, err := object.Version()
+		version, err := object.Version(ctx)
 		if err != nil {
 			return nil, err
 		}
+		if !isEnvironment(version.Name) {
+			continue
+		}
+		if version.Metadata[StatusMetadataKey] == StatusInProgress {
+			continue // a put is still running, or died, and this is its checkpoint
+		}
 		if version.Updated.Before(watermark.Updated) {
 			continue
 		}
@@ -65,15 +95,25 @@ func (s Storage) GetAllNewerVersions(watermark Version) ([]Version, error) {
 	return versions, nil
 }
 
-func (s Storage) Version() (Version, error) {
-	return s.Object.Version()
+func (s Storage) Version(ctx context.Context) (Version, error) {
+	return s.Object.Version(ctx)
+}
+
+func (s Storage) Download(ctx context.Context, targetDir string) (Version, error) {
+	return s.DownloadWithOptions(ctx, targetDir, DownloadOptions{})
 }
 
-func (s Storage) Download(targetDir string) (Version, error) {
-	reader, err := s.Object.NewReader()
+func (s Storage) DownloadWithOptions(ctx context.Context, targetDir string, opts DownloadOptions) (Version, error) {
+	err := opts.validate()
 	if err != nil {
-		if err == ObjectNotFoundError {
-			return s.Upload(targetDir)
+		return Version{}, err
+	}
+	opts.ReadOnly = opts.ReadOnly || s.ReadOnly
+
+	reader, err := s.Object.NewReader(ctx)
+	if err != nil {
+		if err == ObjectNotFoundError && !opts.ReadOnly {
+			return s.Upload(ctx, targetDir)
 		}
 		return Version{}, err
 	}
@@ -84,12 +124,28 @@ func (s Storage) Download(targetDir string) (Version, error) {
 		return Version{}, err
 	}
 
+	var source io.Reader = reader
+	if s.ContentAddressed {
+		buffered := bufio.NewReader(reader)
+		if isManifest(buffered) {
+			err = s.downloadContentAddressed(ctx, buffered, targetDir, opts)
+			if err != nil {
+				return Version{}, err
+			}
+			return s.Version(ctx)
+		}
+		source = buffered
+	}
+
 	handler := func(ctx context.Context, f archiver.File) error {
 		hdr, ok := f.Header.(*tar.Header)
 
 		if !ok {
 			return nil
 		}
+		if !opts.selects(f.NameInArchive) {
+			return nil
+		}
 
 		var fpath = filepath.Join(targetDir, f.NameInArchive)
 
@@ -156,24 +212,28 @@ func (s Storage) Download(targetDir string) (Version, error) {
 		}
 	}
 
-	err = s.Archiver.Extract(context.Background(), reader, nil, handler)
+	err = s.Archiver.Extract(ctx, source, nil, handler)
 	if err != nil {
 		return Version{}, err
 	}
 
-	return s.Version()
+	return s.Version(ctx)
 }
 
-func (s Storage) Upload(filePath string) (Version, error) {
-	writer := s.Object.NewWriter()
-	path := make(map[string]string)
-	path[filePath+"/"] = ""
-	diskfiles, err := archiver.FilesFromDisk(nil, path)
-	if err != nil {
-		return Version{}, err
+func (s Storage) Upload(ctx context.Context, filePath string) (Version, error) {
+	return s.UploadWithMetadata(ctx, filePath, nil)
+}
+
+func (s Storage) UploadWithMetadata(ctx context.Context, filePath string, metadata map[string]string) (Version, error) {
+	if s.ReadOnly {
+		return Version{}, ReadOnlyError
+	}
+	if s.ContentAddressed {
+		return s.uploadContentAddressed(ctx, filePath, metadata)
 	}
 
-	err = s.Archiver.Archive(context.Background(), writer, diskfiles)
+	writer := s.Object.NewWriter(ctx, metadata)
+	err := s.Archive(ctx, filePath, writer)
 	if err != nil {
 		return Version{}, err
 	}
@@ -183,10 +243,22 @@ func (s Storage) Upload(filePath string) (Version, error) {
 		return Version{}, err
 	}
 
-	return s.Version()
+	return s.Version(ctx)
+}
+
+// writes filePath as a tarball, in the same format Upload would
+func (s Storage) Archive(ctx context.Context, filePath string, output io.Writer) error {
+	path := make(map[string]string)
+	path[filePath+"/"] = ""
+	diskfiles, err := archiver.FilesFromDisk(nil, path)
+	if err != nil {
+		return err
+	}
+
+	return s.Archiver.Archive(ctx, output, diskfiles)
 }
 
 // test cleanup only
-func (s Storage) DeleteBucket() error {
-	return s.Bucket.Delete()
+func (s Storage) DeleteBucket(ctx context.Context) error {
+	return s.Bucket.Delete(ctx)
 }
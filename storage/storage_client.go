@@ -1,13 +1,33 @@
 package storage
 
+import (
+	"context"
+	"io"
+)
+
 type StorageClient interface {
-	Download(filePath string) (Version, error)
-	Upload(filePath string) (Version, error)
-	Version() (Version, error)
-	GetAllNewerVersions(watermark Version) ([]Version, error)
-	DeleteBucket() error // test cleanup only
+	Download(ctx context.Context, filePath string) (Version, error)
+	DownloadWithOptions(ctx context.Context, filePath string, opts DownloadOptions) (Version, error)
+	Upload(ctx context.Context, filePath string) (Version, error)
+	UploadWithMetadata(ctx context.Context, filePath string, metadata map[string]string) (Version, error)
+	Archive(ctx context.Context, filePath string, output io.Writer) error
+	Version(ctx context.Context) (Version, error)
+	GetAllNewerVersions(ctx context.Context, watermark Version) ([]Version, error)
+	WriteRecord(ctx context.Context, kind string, contents []byte) error
+	ReadRecords(ctx context.Context, kind string) ([][]byte, error)
+	DeleteBucket(ctx context.Context) error // test cleanup only
+}
+
+type Options struct {
+	ContentAddressed bool
+	// create the bucket if it doesn't exist, instead of failing with BucketNotFoundError
+	CreateBucket bool
+	// never create or change anything: uploads fail, and missing objects stay missing
+	ReadOnly bool
+	// zero fields fall back to DefaultRetryPolicy
+	Retry RetryPolicy
 }
 
-func NewStorageClient(gcpServiceAccountKey, objectName, bucketName string) (StorageClient, error) {
-	return NewGCSStorage(gcpServiceAccountKey, objectName, bucketName)
+func NewStorageClient(ctx context.Context, gcpServiceAccountKey, objectName, bucketName string, opts Options) (StorageClient, error) {
+	return NewGCSStorage(ctx, gcpServiceAccountKey, objectName, bucketName, opts)
 }
@@ -1,6 +1,10 @@
 package storage_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -94,7 +98,7 @@ var _ = Describe("Storage", func() {
 
 	Describe("Upload", func() {
 		It("tars the contents of filepath and uploads them", func() {
-			version, err := store.Upload(storageDir)
+			version, err := store.Upload(ctx, storageDir)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(version.Ref).To(Equal("fresh-version"))
 
@@ -105,13 +109,19 @@ var _ = Describe("Storage", func() {
 			Expect(fakeWriteCloser.CloseCall.CallCount).To(Equal(1))
 		})
 
+		It("attaches metadata to the uploaded object", func() {
+			_, err := store.UploadWithMetadata(ctx, storageDir, map[string]string{"status": "complete"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeObject.NewWriterCall.Receives.Metadata).To(Equal(map[string]string{"status": "complete"}))
+		})
+
 		Context("when archiving the file returns an error", func() {
 			BeforeEach(func() {
 				fakeTarrer.ArchiveCall.Returns.Error = errors.New("coconut")
 			})
 
 			It("returns an error", func() {
-				_, err := store.Upload(storageDir)
+				_, err := store.Upload(ctx, storageDir)
 				Expect(err).To(MatchError("coconut"))
 
 				Expect(fakeWriteCloser.CloseCall.CallCount).To(Equal(0))
@@ -124,7 +134,7 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := store.Upload(storageDir)
+				_, err := store.Upload(ctx, storageDir)
 				Expect(err).To(MatchError("mango"))
 			})
 		})
@@ -133,7 +143,7 @@ var _ = Describe("Storage", func() {
 	Describe("Download", func() {
 		Context("when the object already exists", func() {
 			It("downloads the object and untars it", func() {
-				version, err := store.Download(storageDir)
+				version, err := store.Download(ctx, storageDir)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(version.Ref).To(Equal("fresh-version"))
 
@@ -150,7 +160,7 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("uploads an the appropriate object", func() {
-				version, err := store.Download(storageDir)
+				version, err := store.Download(ctx, storageDir)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(version.Ref).To(Equal("fresh-version"))
 
@@ -163,6 +173,24 @@ var _ = Describe("Storage", func() {
 				Expect(fakeReadCloser.CloseCall.CallCount).To(Equal(0))
 				Expect(fakeWriteCloser.CloseCall.CallCount).To(Equal(1))
 			})
+
+			Context("when downloading read only", func() {
+				It("returns the error without creating the object", func() {
+					_, err := store.DownloadWithOptions(ctx, storageDir, storage.DownloadOptions{ReadOnly: true})
+					Expect(err).To(Equal(storage.ObjectNotFoundError))
+
+					Expect(fakeTarrer.ArchiveCall.CallCount).To(Equal(0))
+					Expect(fakeWriteCloser.CloseCall.CallCount).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when a files pattern is malformed", func() {
+			It("returns an error before reading anything", func() {
+				_, err := store.DownloadWithOptions(ctx, storageDir, storage.DownloadOptions{Files: []string{"vars/["}})
+				Expect(err).To(MatchError(ContainSubstring(`invalid files pattern "vars/["`)))
+				Expect(fakeObject.NewReaderCall.CallCount).To(Equal(0))
+			})
 		})
 
 		Context("when reading the object returns an error", func() {
@@ -171,7 +199,7 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := store.Download(storageDir)
+				_, err := store.Download(ctx, storageDir)
 				Expect(err).To(MatchError("papaya"))
 
 				Expect(fakeTarrer.ExtractCall.CallCount).To(Equal(0))
@@ -188,7 +216,7 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := store.Download(storageDir)
+				_, err := store.Download(ctx, storageDir)
 				Expect(err).To(MatchError("mango"))
 
 				Expect(fakeTarrer.ArchiveCall.CallCount).To(Equal(0))
@@ -204,15 +232,173 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := store.Download(storageDir)
+				_, err := store.Download(ctx, storageDir)
 				Expect(err).To(MatchError("mango"))
 			})
 		})
 	})
 
+	Describe("ContentAddressed", func() {
+		var manifestObject *fakes.MemoryObject
+
+		BeforeEach(func() {
+			manifestObject = &fakes.MemoryObject{Name: "passionfruit"}
+			store.Object = manifestObject
+			store.ContentAddressed = true
+		})
+
+		blobs := func() map[string]*fakes.MemoryObject {
+			result := map[string]*fakes.MemoryObject{}
+			for name, object := range fakeBucket.ObjectCall.Returns.Objects {
+				result[name] = object.(*fakes.MemoryObject)
+			}
+			return result
+		}
+
+		It("uploads each file as a blob and the object as a manifest", func() {
+			_, err := store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeTarrer.ArchiveCall.CallCount).To(Equal(0))
+			Expect(blobs()).To(HaveLen(2))
+			for name := range blobs() {
+				Expect(name).To(HavePrefix("blobs/sha256/"))
+			}
+			Expect(string(manifestObject.Contents)).To(ContainSubstring(`"path":"nested-dir/nested-data.json"`))
+		})
+
+		It("only uploads blobs that have changed", func() {
+			_, err := store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+			firstRef := manifestObject.Contents
+
+			err = ioutil.WriteFile(filename, []byte("guava"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifestObject.Contents).NotTo(Equal(firstRef))
+			Expect(blobs()).To(HaveLen(3))
+			for _, blob := range blobs() {
+				Expect(blob.WriteCount).To(Equal(1))
+			}
+		})
+
+		It("reassembles the directory on download", func() {
+			_, err := store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			targetDir, err := ioutil.TempDir("", "target_dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(targetDir)
+
+			_, err = store.Download(ctx, targetDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTarrer.ExtractCall.CallCount).To(Equal(0))
+
+			expected, err := ioutil.ReadFile(filepath.Join(nestedDirectory, "nested-data.json"))
+			Expect(err).NotTo(HaveOccurred())
+			actual, err := ioutil.ReadFile(filepath.Join(targetDir, "nested-dir", "nested-data.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		})
+
+		It("only downloads the selected files", func() {
+			err := ioutil.WriteFile(filepath.Join(nestedDirectory, "other-data.json"), []byte("feijoa"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			targetDir, err := ioutil.TempDir("", "target_dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(targetDir)
+
+			_, err = store.DownloadWithOptions(ctx, targetDir, storage.DownloadOptions{Files: []string{"bbl-state.json", "nested-dir/nested-*"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(targetDir, "bbl-state.json")).To(BeAnExistingFile())
+			Expect(filepath.Join(targetDir, "nested-dir", "nested-data.json")).To(BeAnExistingFile())
+			Expect(filepath.Join(targetDir, "nested-dir", "other-data.json")).NotTo(BeAnExistingFile())
+
+			targetDir2, err := ioutil.TempDir("", "target_dir")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(targetDir2)
+
+			_, err = store.DownloadWithOptions(ctx, targetDir2, storage.DownloadOptions{Files: []string{"nested-dir/"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(targetDir2, "bbl-state.json")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(targetDir2, "nested-dir", "nested-data.json")).To(BeAnExistingFile())
+			Expect(filepath.Join(targetDir2, "nested-dir", "other-data.json")).To(BeAnExistingFile())
+		})
+
+		Context("when the object was uploaded as a tarball", func() {
+			BeforeEach(func() {
+				manifestObject.Contents = []byte{0x1f, 0x8b}
+				manifestObject.Exists = true
+			})
+
+			It("extracts it like any other tarball", func() {
+				_, err := store.Download(ctx, storageDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeTarrer.ExtractCall.CallCount).To(Equal(1))
+			})
+		})
+
+		It("names each blob after the digest of what it holds", func() {
+			_, err := store.Upload(ctx, storageDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			for name, blob := range blobs() {
+				gz, err := gzip.NewReader(bytes.NewReader(blob.Contents))
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := ioutil.ReadAll(gz)
+				Expect(err).NotTo(HaveOccurred())
+
+				digest := sha256.Sum256(contents)
+				Expect(name).To(Equal("blobs/sha256/" + hex.EncodeToString(digest[:])))
+			}
+		})
+
+		Context("when a blob doesn't hold what its digest says", func() {
+			It("returns an error instead of the wrong contents", func() {
+				_, err := store.Upload(ctx, storageDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				var corrupt bytes.Buffer
+				gz := gzip.NewWriter(&corrupt)
+				_, err = gz.Write([]byte("not what was uploaded"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(gz.Close()).To(Succeed())
+				for _, blob := range blobs() {
+					blob.Contents = corrupt.Bytes()
+				}
+
+				targetDir, err := ioutil.TempDir("", "target_dir")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(targetDir)
+
+				_, err = store.Download(ctx, targetDir)
+				Expect(err).To(MatchError(ContainSubstring("is corrupt")))
+			})
+		})
+
+		Context("when a blob is missing", func() {
+			It("returns an error", func() {
+				_, err := store.Upload(ctx, storageDir)
+				Expect(err).NotTo(HaveOccurred())
+				fakeBucket.ObjectCall.Returns.Objects = nil
+
+				_, err = store.Download(ctx, storageDir)
+				Expect(err).To(MatchError(ContainSubstring("reading blob")))
+			})
+		})
+	})
+
 	Describe("Version", func() {
 		It("returns the objects version", func() {
-			version, err := store.Version()
+			version, err := store.Version(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(version.Ref).To(Equal("fresh-version"))
 			Expect(version.Name).To(Equal("passionfruit"))
@@ -224,12 +410,58 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := store.Version()
+				_, err := store.Version(ctx)
 				Expect(err).To(MatchError("mango"))
 			})
 		})
 	})
 
+	Describe("ReadOnly", func() {
+		BeforeEach(func() {
+			store.ReadOnly = true
+			fakeObject.NewReaderCall.Returns.Error = storage.ObjectNotFoundError
+		})
+
+		It("never creates a missing object", func() {
+			_, err := store.Download(ctx, storageDir)
+			Expect(err).To(Equal(storage.ObjectNotFoundError))
+			Expect(fakeObject.NewWriterCall.CallCount).To(Equal(0))
+		})
+
+		It("refuses to upload", func() {
+			_, err := store.Upload(ctx, storageDir)
+			Expect(err).To(Equal(storage.ReadOnlyError))
+
+			err = store.WriteRecord(ctx, "audit", []byte(`{}`))
+			Expect(err).To(Equal(storage.ReadOnlyError))
+
+			Expect(fakeObject.NewWriterCall.CallCount).To(Equal(0))
+			Expect(fakeBucket.ObjectCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Describe("Records", func() {
+		It("reads back the records written for this environment, oldest first", func() {
+			Expect(store.WriteRecord(ctx, "audit", []byte(`{"command": "up"}`))).To(Succeed())
+			Expect(store.WriteRecord(ctx, "audit", []byte(`{"command": "down"}`))).To(Succeed())
+
+			other := store
+			other.Name = "breadfruit"
+			Expect(other.WriteRecord(ctx, "audit", []byte(`{"command": "rotate"}`))).To(Succeed())
+
+			records, err := store.ReadRecords(ctx, "audit")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(Equal([][]byte{[]byte(`{"command": "up"}`), []byte(`{"command": "down"}`)}))
+			Expect(fakeBucket.ObjectsWithPrefixCall.Receives.Prefix).To(Equal("passionfruit/audit/"))
+		})
+
+		It("returns nothing when there aren't any", func() {
+			records, err := store.ReadRecords(ctx, "audit")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+		})
+	})
+
 	Describe("GetAllNewerVersions", func() {
 		var version storage.Version
 		BeforeEach(func() {
@@ -237,7 +469,13 @@ var _ = Describe("Storage", func() {
 		})
 
 		It("returns the versions for each newer object in the bucket", func() {
-			versions, err := store.GetAllNewerVersions(version)
+			blob := &fakes.Object{}
+			blob.VersionCall.Returns.Version = storage.Version{Name: "blobs/sha256/abc", Ref: "blob-version", Updated: time.Unix(1, 0)}
+			record := &fakes.Object{}
+			record.VersionCall.Returns.Version = storage.Version{Name: "passionfruit/audit/20200101T000000.000000000Z.json", Ref: "record-version", Updated: time.Unix(1, 0)}
+			fakeBucket.ObjectsCall.Returns.Objects = append(fakeBucket.ObjectsCall.Returns.Objects, blob, record)
+
+			versions, err := store.GetAllNewerVersions(ctx, version)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(versions).To(ConsistOf([]storage.Version{
 				{Name: "passionfruit", Ref: "fresh-version", Updated: time.Unix(1, 0)},
@@ -246,13 +484,28 @@ var _ = Describe("Storage", func() {
 			}))
 		})
 
+		It("skips checkpoints of puts that haven't finished", func() {
+			checkpoint := &fakes.Object{}
+			checkpoint.VersionCall.Returns.Version = storage.Version{
+				Name:     "soursop",
+				Ref:      "half-baked",
+				Updated:  time.Unix(2, 0),
+				Metadata: map[string]string{storage.StatusMetadataKey: storage.StatusInProgress},
+			}
+			fakeBucket.ObjectsCall.Returns.Objects = append(fakeBucket.ObjectsCall.Returns.Objects, checkpoint)
+
+			versions, err := store.GetAllNewerVersions(ctx, version)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(HaveLen(3))
+		})
+
 		Context("when we fail to list buckets", func() {
 			BeforeEach(func() {
 				fakeBucket.ObjectsCall.Returns.Error = errors.New("durian")
 			})
 
 			It("returns the error", func() {
-				_, err := store.GetAllNewerVersions(version)
+				_, err := store.GetAllNewerVersions(ctx, version)
 				Expect(err).To(MatchError("durian"))
 			})
 		})
@@ -263,7 +516,7 @@ var _ = Describe("Storage", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := store.GetAllNewerVersions(version)
+				_, err := store.GetAllNewerVersions(ctx, version)
 				Expect(err).To(MatchError("durian"))
 			})
 		})